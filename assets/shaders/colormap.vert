@@ -16,14 +16,34 @@
 uniform mat4 ProjMatrix;
 uniform mat4 ViewMatrix;
 uniform mat4 ModelMatrix;
+uniform mat4 JointMatrix[32];
+uniform bool Skinned;
+uniform float MorphWeights[4];
 
 in vec3 MCVertex;
 in vec3 MCNormal;
 in vec2 TexCoord0;
+in vec4 Joints0;
+in vec4 Weights0;
+in vec3 MorphPosition0;
+in vec3 MorphPosition1;
+in vec3 MorphPosition2;
+in vec3 MorphPosition3;
 
 out vec2 TexCoord;
 
 void main() {
     TexCoord = TexCoord0;
-    gl_Position = ProjMatrix * ViewMatrix * ModelMatrix * vec4(MCVertex, 1);
+    mat4 skinMatrix = mat4(1.0);
+    float weight = dot(Weights0, vec4(1.0));
+    if (Skinned && weight > 0.0) {
+        skinMatrix = (Weights0.x * JointMatrix[int(Joints0.x)] +
+                      Weights0.y * JointMatrix[int(Joints0.y)] +
+                      Weights0.z * JointMatrix[int(Joints0.z)] +
+                      Weights0.w * JointMatrix[int(Joints0.w)]) / weight;
+    }
+    vec3 position = MCVertex +
+        MorphWeights[0] * MorphPosition0 + MorphWeights[1] * MorphPosition1 +
+        MorphWeights[2] * MorphPosition2 + MorphWeights[3] * MorphPosition3;
+    gl_Position = ProjMatrix * ViewMatrix * ModelMatrix * skinMatrix * vec4(position, 1);
 }
@@ -17,35 +17,62 @@ uniform mat4 ProjMatrix;
 uniform mat4 ViewMatrix;
 uniform mat4 ModelMatrix;
 uniform vec3 LightPos;
+uniform mat4 JointMatrix[32];
+uniform bool Skinned;
+uniform float MorphWeights[3];
 
 layout( location = 0 ) in vec3 MCVertex;
 layout( location = 1 ) in vec3 MCNormal;
 layout( location = 2 ) in vec2 TexCoord0;
+layout( location = 3 ) in vec4 MCTangent;
+in vec4 Joints0;
+in vec4 Weights0;
+// Three morph targets, with their tangents, keep the vertex inputs within
+// the 16 OpenGL guarantees.
+in vec3 MorphPosition0;
+in vec3 MorphPosition1;
+in vec3 MorphPosition2;
+in vec3 MorphNormal0;
+in vec3 MorphNormal1;
+in vec3 MorphNormal2;
+in vec3 MorphTangent0;
+in vec3 MorphTangent1;
+in vec3 MorphTangent2;
 
 out vec2 TexCoord;
 out vec3 Pos;
 out vec3 LightDir;
 out vec3 EyeDir;
 
-vec3 tangent(vec3 n) {
-  vec3 t = vec3(0.0, 0.0, 0.0);
-  vec3 c1 = cross(n, vec3(0.0, 0.0, 1.0)); 
-  vec3 c2 = cross(n, vec3(0.0, 1.0, 0.0)); 
-  if(length(c1) > length(c2)) {
-    t = c1;	
-  } else {
-    t = c2;	
-  }
-  normalize(t);
-  return t;
-}
+void main() {
+  // Morph targets add their deltas scaled by their weights.
+  vec3 position = MCVertex +
+    MorphWeights[0] * MorphPosition0 + MorphWeights[1] * MorphPosition1 +
+    MorphWeights[2] * MorphPosition2;
+  vec3 morphNormal = MCNormal +
+    MorphWeights[0] * MorphNormal0 + MorphWeights[1] * MorphNormal1 +
+    MorphWeights[2] * MorphNormal2;
+  vec3 morphTangent = MCTangent.xyz +
+    MorphWeights[0] * MorphTangent0 + MorphWeights[1] * MorphTangent1 +
+    MorphWeights[2] * MorphTangent2;
 
+  // Skinned vertices are moved by the weighted sum of their joints.
+  mat4 skinMatrix = mat4(1.0);
+  float weight = dot(Weights0, vec4(1.0));
+  if (Skinned && weight > 0.0) {
+    skinMatrix = (Weights0.x * JointMatrix[int(Joints0.x)] +
+                  Weights0.y * JointMatrix[int(Joints0.y)] +
+                  Weights0.z * JointMatrix[int(Joints0.z)] +
+                  Weights0.w * JointMatrix[int(Joints0.w)]) / weight;
+  }
+  vec4 vertex = skinMatrix * vec4(position, 1.0);
+  vec3 normal = mat3x3(skinMatrix) * morphNormal;
+  vec3 tangent = mat3x3(skinMatrix) * morphTangent;
 
-void main() {
   mat4 mvMatrix = ViewMatrix * ModelMatrix;
-  vec4 ccVertex = mvMatrix * vec4(MCVertex, 1.0);
+  vec4 ccVertex = mvMatrix * vertex;
   gl_Position = ProjMatrix * ccVertex;
-  Pos = vec4(ModelMatrix * vec4(MCVertex, 1.0)).xyz;
+  Pos = vec4(ModelMatrix * vertex).xyz;
 
   TexCoord = vec3(TexCoord0, 1.0).st;
 
@@ -53,13 +80,12 @@ void main() {
   normalMatrix = inverse(normalMatrix);
   normalMatrix = transpose(normalMatrix);
 
-  // TODO: tangent should point in direction of increasing U
-  // TODO: bi-tangent should point in direction of increasing V 
-  vec3 MCTangent = tangent(MCNormal);
+  // Tangent points in direction of increasing U, bi-tangent in direction
+  // of increasing V, w gives the handedness of the bi-tangent.
   mat3 mv3Matrix = mat3x3(mvMatrix);
-  vec3 n = normalize(mv3Matrix * MCNormal);
-  vec3 t = normalize(mv3Matrix * MCTangent);
-  vec3 b = normalize(mv3Matrix * cross(n, t));
+  vec3 n = normalize(mv3Matrix * normal);
+  vec3 t = normalize(mv3Matrix * tangent);
+  vec3 b = cross(n, t) * MCTangent.w;
 
   LightDir = vec3(ViewMatrix * vec4(LightPos, 0.0)) - vec3(ccVertex);
   vec3 v;
@@ -0,0 +1,116 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hurricanerix/shader-tool/model"
+)
+
+// convert reads a model and writes it back out in the format given by the
+// output file's extension, optionally processing it on the way.
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	normals := fs.String("normals", "", "Generate normals: flat, smooth, angle or crease.")
+	crease := fs.Float64("crease", 30, "Angle in degrees above which crease normals are not smoothed.")
+	tangents := fs.Bool("tangents", false, "Generate tangents.")
+	flipX := fs.Bool("flip-x", false, "Mirror the model along the X axis.")
+	flipY := fs.Bool("flip-y", false, "Mirror the model along the Y axis.")
+	flipZ := fs.Bool("flip-z", false, "Mirror the model along the Z axis.")
+	morphWeights := fs.String("morph-weights", "", "Apply the model's morph targets with these weights (separated by commas).")
+	subdivide := fs.String("subdivide", "", "Subdivide the model: loop or catmull-clark.")
+	subdivisions := fs.Int("subdivisions", 1, "Number of times to subdivide the model.")
+	subdivideCrease := fs.Float64("subdivide-crease", 180, "Angle in degrees above which edges are kept sharp when subdividing.")
+	weld := fs.Bool("weld", false, "Weld duplicate vertices and drop unused ones.")
+	weldEpsilon := fs.Float64("weld-epsilon", 0, "Largest difference in any vertex attribute for vertices to be welded.")
+	simplify := fs.Float64("simplify", 1, "Simplify the model to this ratio of its triangles.")
+	optimize := fs.Bool("optimize", false, "Reorder triangles and vertices for the vertex cache and to reduce overdraw.")
+	cacheSize := fs.Int("cache-size", 16, "Number of vertices in the vertex cache to optimize for.")
+	ascii := fs.Bool("ascii", false, "Write text rather than binary PLY or STL files.")
+	workers := fs.Int("workers", 0, "Number of goroutines parsing large text models, or 0 for one per CPU.")
+	progress := fs.Bool("progress", false, "Report progress while loading the model.")
+	var conversions conversion
+	conversions.addFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s convert [options] input output\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	weights, err := parseWeights(*morphWeights)
+	if err != nil {
+		return err
+	}
+	opts := loadOptions(fs.Arg(0), *workers, *progress)
+	if err := conversions.apply(&opts); err != nil {
+		return err
+	}
+	m := model.New()
+	if err := m.LoadFileWith(fs.Arg(0), opts); err != nil {
+		return fmt.Errorf("could not load model: %s", err)
+	}
+
+	m.ApplyMorphs(weights)
+	for axis, flip := range []bool{*flipX, *flipY, *flipZ} {
+		if flip {
+			t := [16]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+			t[axis*5] = -1
+			m.Transform(t)
+		}
+	}
+	if *subdivide != "" {
+		scheme, err := model.ParseSubdivisionScheme(*subdivide)
+		if err != nil {
+			return err
+		}
+		m = m.Subdivide(scheme, *subdivisions, *subdivideCrease)
+	}
+	if *normals != "" {
+		mode, err := model.ParseNormalMode(*normals)
+		if err != nil {
+			return err
+		}
+		m.GenerateNormals(mode, *crease)
+		// Tangents the model had are made again to match the new normals.
+		*tangents = *tangents || m.HasTangents
+	}
+	if *tangents {
+		m.GenerateTangents()
+	}
+	if *weld {
+		m.Weld(float32(*weldEpsilon))
+	}
+	if *simplify < 1 {
+		m = m.Simplify(int(*simplify * float64(m.FaceCount)))
+	}
+	if *optimize {
+		before := m.ACMR(*cacheSize)
+		m.OptimizeTriangles(*cacheSize)
+		m.OptimizeVertexFetch()
+		fmt.Printf("ACMR: %.3f -> %.3f\n", before, m.ACMR(*cacheSize))
+	}
+
+	if err := m.SaveFile(fs.Arg(1), *ascii); err != nil {
+		return fmt.Errorf("could not save model: %s", err)
+	}
+	return nil
+}
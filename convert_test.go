@@ -0,0 +1,53 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hurricanerix/shader-tool/model"
+)
+
+func TestConvert(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "cube.ply")
+	args := []string{"-normals", "flat", "-tangents", "-scale", "2", "-ascii", model.BuiltinPrefix + "cube", out}
+	if err := convert(args); err != nil {
+		t.Fatal(err)
+	}
+	m := model.New()
+	if err := m.LoadFile(out); err != nil {
+		t.Fatal(err)
+	}
+	if m.Format != "format ascii 1.0" || m.FaceCount != 12 || m.VertexCount != 36 {
+		t.Errorf("got %s with %d vertices and %d faces, want ascii PLY with 36 and 12", m.Format, m.VertexCount, m.FaceCount)
+	}
+	if !m.HasNormals || !m.HasTangents {
+		t.Errorf("got normals %t and tangents %t, want both", m.HasNormals, m.HasTangents)
+	}
+	if min, max := m.Bounds(); min != [3]float32{-2, -2, -2} || max != [3]float32{2, 2, 2} {
+		t.Errorf("got bounds %v - %v, want the cube scaled to [-2 -2 -2] - [2 2 2]", min, max)
+	}
+
+	for _, args := range [][]string{
+		{"-subdivide", "doo-sabin", model.BuiltinPrefix + "cube", out},
+		{"-morph-weights", "1,x", model.BuiltinPrefix + "cube", out},
+		{model.BuiltinPrefix + "cube", filepath.Join(filepath.Dir(out), "cube.txt")},
+	} {
+		if err := convert(args); err == nil {
+			t.Errorf("convert %v succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hurricanerix/shader-tool/model"
+)
+
+// inspect prints statistics and diagnostics for each model given.
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the report as JSON.")
+	workers := fs.Int("workers", 0, "Number of goroutines parsing large text models, or 0 for one per CPU.")
+	progress := fs.Bool("progress", false, "Report progress while loading each model.")
+	var conversions conversion
+	conversions.addFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s inspect [options] model...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	reports := make(map[string]model.Stats)
+	printed, failed := 0, 0
+	for _, filename := range fs.Args() {
+		opts := loadOptions(filename, *workers, *progress)
+		if err := conversions.apply(&opts); err != nil {
+			return err
+		}
+		m := model.New()
+		if err := m.LoadFileWith(filename, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %s\n", filename, err)
+			failed++
+			continue
+		}
+		s := m.Stats()
+		if *asJSON {
+			reports[filename] = s
+			continue
+		}
+		if printed > 0 {
+			fmt.Println()
+		}
+		printStats(filename, s)
+		printed++
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not load %d of %d models", failed, fs.NArg())
+	}
+	return nil
+}
+
+func printStats(filename string, s model.Stats) {
+	fmt.Printf("%s\n", filename)
+	fmt.Printf("  format:                %s\n", s.Format)
+	fmt.Printf("  vertices:              %d\n", s.Vertices)
+	fmt.Printf("  triangles:             %d\n", s.Triangles)
+	fmt.Printf("  groups:                %d\n", s.Groups)
+	fmt.Printf("  materials:             %d\n", s.Materials)
+	if s.Skins > 0 {
+		fmt.Printf("  skins:                 %d, up to %d joints\n", s.Skins, s.Joints)
+	}
+	if s.Morphs > 0 {
+		fmt.Printf("  morph targets:         %d\n", s.Morphs)
+	}
+	if len(s.Animations) > 0 {
+		fmt.Printf("  animations:            %s\n", strings.Join(s.Animations, ", "))
+	}
+	fmt.Printf("  normals:               %t\n", s.HasNormals)
+	fmt.Printf("  texture coordinates:   %t\n", s.HasTexCoords)
+	fmt.Printf("  tangents:              %t\n", s.HasTangents)
+	if len(s.Attributes) > 0 {
+		fmt.Printf("  other attributes:      %s\n", strings.Join(s.Attributes, ", "))
+	}
+	fmt.Printf("  bounds:                %v - %v\n", s.BoundsMin, s.BoundsMax)
+	if s.HasTexCoords {
+		fmt.Printf("  texture range:         %v - %v\n", s.TexCoordMin, s.TexCoordMax)
+	}
+	fmt.Printf("  out of range indices:  %d\n", s.OutOfRangeIndices)
+	fmt.Printf("  degenerate triangles:  %d\n", s.DegenerateTriangles)
+	fmt.Printf("  duplicate triangles:   %d\n", s.DuplicateTriangles)
+	fmt.Printf("  unreferenced vertices: %d\n", s.UnreferencedVertices)
+	fmt.Printf("  boundary edges:        %d\n", s.BoundaryEdges)
+	fmt.Printf("  non-manifold edges:    %d\n", s.NonManifoldEdges)
+	if s.HasNormals {
+		fmt.Printf("  zero length normals:   %d\n", s.ZeroLengthNormals)
+	}
+}
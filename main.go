@@ -17,37 +17,134 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/hurricanerix/go-gl-utils/app"
 	"github.com/hurricanerix/go-gl-utils/path"
+	"github.com/hurricanerix/shader-tool/model"
 	"github.com/hurricanerix/shader-tool/scene"
 )
 
 var (
-	modelFile  string
-	colorFile  string
-	normalFile string
-	vertFiles  string
-	fragFiles  string
+	modelFile   string
+	colorFile   string
+	normalFile  string
+	vertFiles   string
+	fragFiles   string
+	normals     string
+	creaseAngle float64
+	fit         bool
+	weld        bool
+	weldEpsilon float64
+	optimize    bool
+	cacheSize   int
+	lods        string
+	workers     int
+	progress    bool
+	conversions conversion
+
+	subdivision       string
+	subdivisions      int
+	subdivisionCrease float64
+
+	animation    string
+	paused       bool
+	morphWeights string
 )
 
 func init() {
-	flag.StringVar(&modelFile, "model", "assets/models/cube.ply", "Filename of 3D model to render.")
+	flag.StringVar(&modelFile, "model", "assets/models/cube.ply", "Filename of 3D model to render (PLY, OBJ, glTF or STL), or the name of a builtin model such as builtin:torus.")
 	flag.StringVar(&colorFile, "color", "", "Filename of texture to use for color map.")
 	flag.StringVar(&normalFile, "normal", "", "Filename of texture to use for normal map.")
 	flag.StringVar(&vertFiles, "vert", "assets/shaders/normalmap.vert", "List of vertex shader filenames to compile (separated by commas).")
 	flag.StringVar(&fragFiles, "frag", "assets/shaders/normalmap.frag", "List of fragment shaders filenames to compile (separated by commas).")
+	flag.StringVar(&normals, "normals", "", "Generate normals: flat, smooth, angle or crease. By default the model's own normals are used, or angle if it has none.")
+	flag.Float64Var(&creaseAngle, "crease", 30, "Angle in degrees above which crease normals are not smoothed.")
+	flag.BoolVar(&fit, "fit", true, "Center and scale the model to fit the view. If false, the camera is moved to fit the model instead.")
+	flag.BoolVar(&weld, "weld", false, "Weld duplicate vertices and drop unused ones.")
+	flag.Float64Var(&weldEpsilon, "weld-epsilon", 0, "Largest difference in any vertex attribute for vertices to be welded.")
+	flag.BoolVar(&optimize, "optimize", false, "Reorder triangles and vertices for the vertex cache and to reduce overdraw.")
+	flag.IntVar(&cacheSize, "cache-size", 16, "Number of vertices in the vertex cache to optimize for.")
+	flag.StringVar(&lods, "lods", "", "List of levels of detail to simplify the model to, as ratios of its triangles (separated by commas).")
+	flag.StringVar(&subdivision, "subdivide", "", "Subdivide the model: loop or catmull-clark.")
+	flag.IntVar(&subdivisions, "subdivisions", 1, "Number of times to subdivide the model.")
+	flag.Float64Var(&subdivisionCrease, "subdivide-crease", 180, "Angle in degrees above which edges are kept sharp when subdividing.")
+	flag.StringVar(&animation, "animation", "", "Name or index of the animation to play. By default the first is played.")
+	flag.BoolVar(&paused, "paused", false, "Start with the animation paused.")
+	flag.StringVar(&morphWeights, "morph-weights", "", "List of weights of the model's morph targets (separated by commas). By default the model's own weights are used.")
+	flag.IntVar(&workers, "workers", 0, "Number of goroutines parsing large text models, or 0 for one per CPU.")
+	flag.BoolVar(&progress, "progress", false, "Report progress while loading the model.")
+	conversions.addFlags(flag.CommandLine)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		commands := map[string]func([]string) error{
+			"convert": convert,
+			"inspect": inspect,
+		}
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
 	if err := path.SetWorkingDir("github.com/hurricanerix/shader-tool"); err != nil {
 		panic(err)
 	}
-}
-
-func main() {
 	flag.Parse()
 
+	lodRatios, err := parseRatios(lods)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	weights, err := parseWeights(morphWeights)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	opts := loadOptions(modelFile, workers, progress)
+	if err := conversions.apply(&opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Create an instance of your scene.
+	// See app.Scene for details on this interface.
+	s := &scene.Scene{
+		ModelFile:   modelFile,
+		ColorFile:   colorFile,
+		NormalFile:  normalFile,
+		VertFiles:   strings.Split(vertFiles, ","),
+		FragFiles:   strings.Split(fragFiles, ","),
+		Normals:     normals,
+		CreaseAngle: creaseAngle,
+		Fit:         fit,
+		Weld:        weld,
+		WeldEpsilon: weldEpsilon,
+		Optimize:    optimize,
+		CacheSize:   cacheSize,
+		LODRatios:   lodRatios,
+		LoadOptions: opts,
+
+		Subdivision:       subdivision,
+		Subdivisions:      subdivisions,
+		SubdivisionCrease: subdivisionCrease,
+
+		Animation:    animation,
+		Paused:       paused,
+		MorphWeights: weights,
+	}
+
 	// Create a config.  See app.Config for details on supported values.
 	c := app.Config{
 		Name:                "Shader Tool",
@@ -59,17 +156,7 @@ func main() {
 			mgl32.Vec2{4, 1}, // If that fails, try to load a 4.1 contex.
 			// If all fail, a.Run() will return an error.
 		},
-		KeyCallback: scene.KeyCallback,
-	}
-
-	// Create an instance of your scene.
-	// See app.Scene for details on this interface.
-	s := &scene.Scene{
-		ModelFile:  modelFile,
-		ColorFile:  colorFile,
-		NormalFile: normalFile,
-		VertFiles:  strings.Split(vertFiles, ","),
-		FragFiles:  strings.Split(fragFiles, ","),
+		KeyCallback: s.KeyCallback,
 	}
 
 	// Create a new app, providing a config and scene.
@@ -78,3 +165,116 @@ func main() {
 		panic(err)
 	}
 }
+
+// parseRatios parses a comma separated list of ratios between 0 and 1.
+func parseRatios(list string) ([]float64, error) {
+	var ratios []float64
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		r, err := strconv.ParseFloat(f, 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("invalid ratio: %s", f)
+		}
+		ratios = append(ratios, r)
+	}
+	return ratios, nil
+}
+
+// parseWeights parses a comma separated list of morph target weights.
+func parseWeights(list string) ([]float32, error) {
+	var weights []float32
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		w, err := strconv.ParseFloat(f, 32)
+		if err != nil || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight: %s", f)
+		}
+		weights = append(weights, float32(w))
+	}
+	return weights, nil
+}
+
+// conversion holds the flags converting models as they are loaded.
+type conversion struct {
+	up          string
+	scale       float64
+	matrix      string
+	flipWinding bool
+	flipV       bool
+	texCoords   string
+}
+
+// addFlags defines the conversion flags in fs.
+func (c *conversion) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.up, "up", "y", "Axis pointing up in the model: x, y or z.")
+	fs.Float64Var(&c.scale, "scale", 1, "Scale the model by this factor.")
+	fs.StringVar(&c.matrix, "matrix", "", "Transform the model by this column-major 4x4 matrix (16 numbers separated by commas).")
+	fs.BoolVar(&c.flipWinding, "flip-winding", false, "Reverse the winding of each triangle.")
+	fs.BoolVar(&c.flipV, "flip-v", false, "Flip texture coordinates vertically.")
+	fs.StringVar(&c.texCoords, "texcoords", "none", "Generate texture coordinates: planar, box, spherical or cylindrical.")
+}
+
+// apply sets the conversions given by the flags in opts.
+func (c conversion) apply(opts *model.LoadOptions) error {
+	up, err := model.ParseUpAxis(c.up)
+	if err != nil {
+		return err
+	}
+	opts.Up = up
+	opts.Scale = float32(c.scale)
+	if c.matrix != "" {
+		if opts.Matrix, err = parseMatrix(c.matrix); err != nil {
+			return err
+		}
+	}
+	if opts.TexCoords, err = model.ParseProjection(c.texCoords); err != nil {
+		return err
+	}
+	opts.FlipWinding = c.flipWinding
+	opts.FlipV = c.flipV
+	return nil
+}
+
+// parseMatrix parses a comma separated list of the 16 numbers of a matrix.
+func parseMatrix(list string) ([16]float32, error) {
+	var m [16]float32
+	fields := strings.Split(list, ",")
+	if len(fields) != len(m) {
+		return m, fmt.Errorf("invalid matrix: %s (expected 16 numbers)", list)
+	}
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 32)
+		if err != nil {
+			return m, fmt.Errorf("invalid matrix: %s", list)
+		}
+		m[i] = float32(v)
+	}
+	return m, nil
+}
+
+// loadOptions returns the options to load filename with, printing the
+// percentage read to stderr if progress is set.
+func loadOptions(filename string, workers int, progress bool) model.LoadOptions {
+	opts := model.LoadOptions{Workers: workers}
+	if !progress {
+		return opts
+	}
+	last := int64(-1)
+	opts.Progress = func(read, size int64) {
+		if size <= 0 {
+			return
+		}
+		if p := 100 * read / size; p != last {
+			last = p
+			fmt.Fprintf(os.Stderr, "\rloading %s: %3d%%", filename, p)
+			if read >= size {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+	return opts
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Animation moves the nodes of a model over time.
+type Animation struct {
+	Name     string
+	Channels []Channel
+	Duration float32 // Time of the last key, in seconds.
+}
+
+// ChannelPath is the property of a node a channel animates.
+type ChannelPath int
+
+const (
+	TranslationPath ChannelPath = iota
+	// RotationPath values are quaternions (x, y, z, w).
+	RotationPath
+	ScalePath
+	// WeightsPath values hold a weight for each morph target.
+	WeightsPath
+)
+
+var channelPathNames = [...]string{"translation", "rotation", "scale", "weights"}
+
+func (p ChannelPath) String() string {
+	if p < 0 || int(p) >= len(channelPathNames) {
+		return fmt.Sprintf("ChannelPath(%d)", int(p))
+	}
+	return channelPathNames[p]
+}
+
+// size returns the number of floats in each value of the path, or in each
+// weight of WeightsPath.
+func (p ChannelPath) size() int {
+	switch p {
+	case RotationPath:
+		return 4
+	case WeightsPath:
+		return 1
+	}
+	return 3
+}
+
+// Interpolation is how a channel's values change between keys.
+type Interpolation int
+
+const (
+	// LinearInterpolation blends between keys, along the shortest arc for
+	// rotations.
+	LinearInterpolation Interpolation = iota
+	// StepInterpolation holds the value of each key until the next.
+	StepInterpolation
+	// CubicSplineInterpolation follows a Hermite spline, with the in
+	// tangent, value and out tangent stored for each key.
+	CubicSplineInterpolation
+)
+
+// Channel gives the values of a property of a node at a series of keys.
+type Channel struct {
+	Node          int // Index into Nodes.
+	Path          ChannelPath
+	Interpolation Interpolation
+	Times         []float32 // Time of each key, in seconds, ascending.
+	Values        []float32 // Value at each key.
+}
+
+// Pose returns the nodes of m as animation a places them at time t, in
+// seconds.  Times outside the animation hold its first or last keys, and a
+// of -1 returns the nodes at rest.
+func (m Model) Pose(a int, t float32) []Node {
+	pose := append([]Node(nil), m.Nodes...)
+	if a < 0 || a >= len(m.Animations) {
+		return pose
+	}
+	for _, c := range m.Animations[a].Channels {
+		if c.Node < 0 || c.Node >= len(pose) {
+			continue
+		}
+		n := &pose[c.Node]
+		switch v := c.sample(t); c.Path {
+		case TranslationPath:
+			copy(n.Translation[:], v)
+		case RotationPath:
+			var q [4]float32
+			copy(q[:], v)
+			n.Rotation = normalizeQuat(q)
+		case ScalePath:
+			copy(n.Scale[:], v)
+		case WeightsPath:
+			n.Weights = v
+		}
+	}
+	return pose
+}
+
+// size returns the number of floats in each value of c.
+func (c Channel) size() int {
+	if c.Path != WeightsPath {
+		return c.Path.size()
+	}
+	keys := len(c.Times)
+	if c.Interpolation == CubicSplineInterpolation {
+		keys *= 3
+	}
+	if keys == 0 {
+		return 0
+	}
+	return len(c.Values) / keys
+}
+
+// sample returns the value of c at time t, which may share the memory of
+// its values.
+func (c Channel) sample(t float32) []float32 {
+	size := c.size()
+	value := func(k int) []float32 {
+		if c.Interpolation == CubicSplineInterpolation {
+			return c.Values[(3*k+1)*size : (3*k+2)*size]
+		}
+		return c.Values[k*size : (k+1)*size]
+	}
+	n := len(c.Times)
+	if n == 0 {
+		return nil
+	}
+	k := sort.Search(n, func(i int) bool { return c.Times[i] > t }) - 1
+	if k < 0 {
+		return value(0)
+	}
+	if k >= n-1 || c.Interpolation == StepInterpolation {
+		return value(k)
+	}
+
+	dt := c.Times[k+1] - c.Times[k]
+	s := (t - c.Times[k]) / dt
+	out := make([]float32, size)
+	a, b := value(k), value(k+1)
+	switch {
+	case c.Interpolation == CubicSplineInterpolation:
+		outTangent := c.Values[(3*k+2)*size : (3*k+3)*size]
+		inTangent := c.Values[(3*(k+1))*size : (3*(k+1)+1)*size]
+		s2, s3 := s*s, s*s*s
+		for i := range out {
+			out[i] = (2*s3-3*s2+1)*a[i] + (s3-2*s2+s)*dt*outTangent[i] + (-2*s3+3*s2)*b[i] + (s3-s2)*dt*inTangent[i]
+		}
+	case c.Path == RotationPath:
+		var qa, qb [4]float32
+		copy(qa[:], a)
+		copy(qb[:], b)
+		q := slerp(qa, qb, s)
+		copy(out, q[:])
+	default:
+		for i := range out {
+			out[i] = a[i] + (b[i]-a[i])*s
+		}
+	}
+	return out
+}
+
+// AnimationIndex returns the index of the animation with the given name, or
+// -1 if m has none.
+func (m Model) AnimationIndex(name string) int {
+	for i, a := range m.Animations {
+		if a.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestChannelSample(t *testing.T) {
+	times := []float32{1, 3}
+	tests := []struct {
+		name    string
+		channel Channel
+		t       float32
+		want    []float32
+	}{
+		{"linear", Channel{Path: TranslationPath, Times: times, Values: []float32{0, 0, 0, 4, 2, 0}}, 2, []float32{2, 1, 0}},
+		{"before", Channel{Path: TranslationPath, Times: times, Values: []float32{0, 0, 0, 4, 2, 0}}, 0, []float32{0, 0, 0}},
+		{"after", Channel{Path: TranslationPath, Times: times, Values: []float32{0, 0, 0, 4, 2, 0}}, 5, []float32{4, 2, 0}},
+		{"step", Channel{Path: ScalePath, Interpolation: StepInterpolation, Times: times, Values: []float32{1, 1, 1, 2, 2, 2}}, 2.9, []float32{1, 1, 1}},
+		{"rotation", Channel{Path: RotationPath, Times: times, Values: []float32{0, 0, 0, 1, 0, 0, 1, 0}}, 2, []float32{0, 0, 0.70710678, 0.70710678}},
+		{"weights", Channel{Path: WeightsPath, Times: times, Values: []float32{0, 1, 1, 0}}, 1.5, []float32{0.25, 0.75}},
+		// Each key holds an in tangent, a value and an out tangent.  With
+		// flat tangents the spline eases between values, passing through
+		// their mean halfway.
+		{"cubic spline", Channel{Path: WeightsPath, Interpolation: CubicSplineInterpolation, Times: times, Values: []float32{0, 0, 0, 0, 4, 0}}, 2, []float32{2}},
+		{"cubic spline tangents", Channel{Path: WeightsPath, Interpolation: CubicSplineInterpolation, Times: times, Values: []float32{0, 0, 1, 0, 2, 0}}, 2, []float32{1.25}},
+	}
+	for _, test := range tests {
+		got := test.channel.sample(test.t)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for k := range got {
+			if d := got[k] - test.want[k]; d > 1e-5 || d < -1e-5 {
+				t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPose(t *testing.T) {
+	m := skinnedModel()
+	m.Animations = []Animation{{
+		Name:     "wave",
+		Duration: 2,
+		Channels: []Channel{
+			{Node: 1, Path: TranslationPath, Times: []float32{0, 2}, Values: []float32{0, 1, 0, 0, 3, 0}},
+			{Node: 7, Path: ScalePath, Times: []float32{0}, Values: []float32{2, 2, 2}},
+		},
+	}}
+	if i := m.AnimationIndex("wave"); i != 0 {
+		t.Fatalf("AnimationIndex(wave) = %d, want 0", i)
+	}
+	if i := m.AnimationIndex("walk"); i != -1 {
+		t.Errorf("AnimationIndex(walk) = %d, want -1", i)
+	}
+
+	pose := m.Pose(0, 1)
+	if pose[1].Translation != [3]float32{0, 2, 0} {
+		t.Errorf("tip is at %v, want [0 2 0]", pose[1].Translation)
+	}
+	if m.Nodes[1].Translation != [3]float32{0, 1, 0} {
+		t.Errorf("posing moved the tip at rest to %v", m.Nodes[1].Translation)
+	}
+	if rest := m.Pose(-1, 1); rest[1].Translation != [3]float32{0, 1, 0} {
+		t.Errorf("tip at rest is at %v, want [0 1 0]", rest[1].Translation)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// Names of the shader vertex inputs attributes are bound to.  Attributes
+// read from custom model properties keep the name of the property.
+const (
+	PositionAttribute  = "MCVertex"
+	NormalAttribute    = "MCNormal"
+	TexCoordAttribute  = "TexCoord0"
+	TangentAttribute   = "MCTangent"
+	ColorAttribute     = "MCColor"
+	TexCoord1Attribute = "TexCoord1"
+	JointsAttribute    = "Joints0"
+	WeightsAttribute   = "Weights0"
+)
+
+// Attribute is a named range of floats within each vertex of VertexData.
+type Attribute struct {
+	Name   string
+	Offset int // Offset within a vertex.
+	Size   int // Number of floats, 1 to 4.
+}
+
+// standardAttributes are held by every model, at fixed offsets.
+var standardAttributes = []Attribute{
+	{Name: PositionAttribute, Offset: PositionOffset, Size: 3},
+	{Name: NormalAttribute, Offset: NormalOffset, Size: 3},
+	{Name: TexCoordAttribute, Offset: TexCoordOffset, Size: 2},
+	{Name: TangentAttribute, Offset: TangentOffset, Size: 4},
+}
+
+// DefaultValue returns the value of the named attribute for vertices with
+// no data for it: opaque white for colors, zeros for joints and weights,
+// which leave vertices where they are, and (0, 0, 0, 1) otherwise, as
+// OpenGL uses for vertex inputs with no data.
+func DefaultValue(name string) [4]float32 {
+	switch name {
+	case ColorAttribute:
+		return [4]float32{1, 1, 1, 1}
+	case JointsAttribute, WeightsAttribute:
+		return [4]float32{}
+	}
+	return [4]float32{0, 0, 0, 1}
+}
+
+// VertexAttributes returns the standard attributes followed by any others
+// the model has.
+func (m Model) VertexAttributes() []Attribute {
+	return append(append([]Attribute(nil), standardAttributes...), m.Attributes...)
+}
+
+// Attribute returns the named attribute.
+func (m Model) Attribute(name string) (Attribute, bool) {
+	for _, a := range m.VertexAttributes() {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// AddAttribute adds an attribute of size floats to the end of each vertex,
+// set to its default value, and returns it.  If m already has the named
+// attribute it is returned unchanged.
+func (m *Model) AddAttribute(name string, size int) Attribute {
+	if a, ok := m.Attribute(name); ok {
+		return a
+	}
+	a := Attribute{Name: name, Offset: m.Stride, Size: size}
+	def := DefaultValue(name)
+	count := len(m.VertexData) / m.Stride
+	data := make([]float32, 0, count*(m.Stride+size))
+	for i := 0; i < count; i++ {
+		data = append(data, m.VertexData[i*m.Stride:(i+1)*m.Stride]...)
+		data = append(data, def[:size]...)
+	}
+	m.VertexData = data
+	m.Stride += size
+	m.Attributes = append(m.Attributes, a)
+	return a
+}
+
+// defaultVertex returns a vertex with every attribute other than the
+// standard ones set to its default value.
+func (m Model) defaultVertex() []float32 {
+	v := make([]float32, m.Stride)
+	for _, a := range m.Attributes {
+		def := DefaultValue(a.Name)
+		copy(v[a.Offset:a.Offset+a.Size], def[:a.Size])
+	}
+	return v
+}
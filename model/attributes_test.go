@@ -0,0 +1,127 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+// attribute returns the values of the named attribute of vertex i.
+func attribute(m Model, name string, i int) []float32 {
+	a, ok := m.Attribute(name)
+	if !ok {
+		return nil
+	}
+	return m.VertexData[i*m.Stride+a.Offset : i*m.Stride+a.Offset+a.Size]
+}
+
+func TestPLYAttributes(t *testing.T) {
+	data := `ply
+format ascii 1.0
+element vertex 3
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+property float quality
+property float u1
+property float v1
+element face 1
+property list uchar int vertex_indices
+end_header
+0 0 0 255 0 51 0.5 0.25 0.75
+1 0 0 0 255 0 1 0 0
+0 1 0 0 0 255 2 0 0
+3 0 1 2
+`
+	m := New()
+	if err := m.Load(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if m.Stride != VertexSize+4+1+2 {
+		t.Errorf("got stride %d, want %d", m.Stride, VertexSize+4+1+2)
+	}
+	tests := []struct {
+		name string
+		want []float32
+	}{
+		// Integer colors are scaled to 0 to 1, and missing alpha is opaque.
+		{ColorAttribute, []float32{1, 0, 0.2, 1}},
+		{"quality", []float32{0.5}},
+		{TexCoord1Attribute, []float32{0.25, 0.75}},
+	}
+	for _, test := range tests {
+		got := attribute(m, test.name, 0)
+		if len(got) != len(test.want) {
+			t.Errorf("%s is %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for k := range got {
+			if d := got[k] - test.want[k]; d > 1e-6 || d < -1e-6 {
+				t.Errorf("%s is %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestGLTFAttributes(t *testing.T) {
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	js = strings.Replace(js, `"type": "SCALAR"}`, `"type": "SCALAR"},
+    {"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+    {"bufferView": 0, "byteOffset": 12, "componentType": 5126, "count": 3, "type": "SCALAR"}`, 1)
+	js = strings.Replace(js, `"attributes": {"POSITION": 0}`, `"attributes": {"POSITION": 0, "COLOR_0": 2, "_TEMPERATURE": 3}`, 1)
+	m := New()
+	if err := m.Load(strings.NewReader(js)); err != nil {
+		t.Fatal(err)
+	}
+	if got := attribute(m, ColorAttribute, 1); len(got) != 4 || got[0] != 1 || got[1] != 0 || got[3] != 1 {
+		t.Errorf("vertex 1 has color %v, want [1 0 0 1]", got)
+	}
+	for i, want := range []float32{1, 0, 0} {
+		if got := attribute(m, "_TEMPERATURE", i); len(got) != 1 || got[0] != want {
+			t.Errorf("vertex %d has _TEMPERATURE %v, want [%g]", i, got, want)
+		}
+	}
+}
+
+func TestAddAttribute(t *testing.T) {
+	m := savedModel()
+	stride := m.Stride
+	a := m.AddAttribute(ColorAttribute, 4)
+	if m.Stride != stride {
+		t.Errorf("adding an existing attribute changed the stride from %d to %d", stride, m.Stride)
+	}
+	if b, _ := m.Attribute(ColorAttribute); b != a {
+		t.Errorf("got %+v, want the existing %+v", a, b)
+	}
+
+	// New attributes start at their default value.
+	m.AddAttribute("extra", 2)
+	if m.Stride != stride+2 {
+		t.Errorf("got stride %d, want %d", m.Stride, stride+2)
+	}
+	for i := 0; i < m.VertexCount; i++ {
+		if got := attribute(m, "extra", i); got[0] != 0 || got[1] != 0 {
+			t.Errorf("vertex %d has extra %v, want [0 0]", i, got)
+		}
+		if got, want := attribute(m, "quality", i)[0], float32(i+1)/10; got != want {
+			t.Errorf("vertex %d has quality %g, want %g", i, got, want)
+		}
+	}
+}
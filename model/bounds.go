@@ -0,0 +1,76 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// Bounds returns the minimum and maximum corners of the axis-aligned box
+// enclosing the vertices of m, moved by the transforms of their groups.
+func (m Model) Bounds() (min, max [3]float32) {
+	first := true
+	m.eachPosition(func(p [3]float32) {
+		if first {
+			min, max, first = p, p, false
+			return
+		}
+		for k := range p {
+			if p[k] < min[k] {
+				min[k] = p[k]
+			}
+			if p[k] > max[k] {
+				max[k] = p[k]
+			}
+		}
+	})
+	return min, max
+}
+
+// BoundingSphere returns a sphere enclosing the vertices of m, centered on
+// its bounds.
+func (m Model) BoundingSphere() (center [3]float32, radius float32) {
+	min, max := m.Bounds()
+	for k := range center {
+		center[k] = (min[k] + max[k]) / 2
+	}
+	m.eachPosition(func(p [3]float32) {
+		if d := length3(sub3(p, center)); d > radius {
+			radius = d
+		}
+	})
+	return center, radius
+}
+
+// Fit centers m on the origin and scales it uniformly so that its largest
+// extent spans -1 to 1.
+func (m *Model) Fit() {
+	min, max := m.Bounds()
+	size := sub3(max, min)
+	extent := size[0]
+	if size[1] > extent {
+		extent = size[1]
+	}
+	if size[2] > extent {
+		extent = size[2]
+	}
+	s := float32(1)
+	if extent > 0 {
+		s = 2 / extent
+	}
+
+	t := ident4()
+	for k := 0; k < 3; k++ {
+		t[k*5] = s
+		t[12+k] = -(min[k] + max[k]) / 2 * s
+	}
+	m.Transform(t)
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	m := New()
+	if err := m.Load(strings.NewReader("v 2 3 4\nv 6 3 4\nv 2 5 5\nf 1 2 3\n")); err != nil {
+		t.Fatal(err)
+	}
+	min, max := m.Bounds()
+	if min != [3]float32{2, 3, 4} || max != [3]float32{6, 5, 5} {
+		t.Fatalf("got bounds %v - %v, want [2 3 4] - [6 5 5]", min, max)
+	}
+	center, radius := m.BoundingSphere()
+	if center != [3]float32{4, 4, 4.5} || radius < 2.29 || radius > 2.30 {
+		t.Errorf("got bounding sphere at %v of radius %g, want [4 4 4.5] of 2.29", center, radius)
+	}
+
+	// The largest extent, along X, spans -1 to 1, and the others keep
+	// their proportions.
+	m.Fit()
+	min, max = m.Bounds()
+	if min != [3]float32{-1, -0.5, -0.25} || max != [3]float32{1, 0.5, 0.25} {
+		t.Errorf("got bounds %v - %v after fitting, want [-1 -0.5 -0.25] - [1 0.5 0.25]", min, max)
+	}
+}
+
+func TestBoundsWithTransforms(t *testing.T) {
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	js = strings.Replace(js, `"nodes": [{"mesh": 0}]`, `"nodes": [{"mesh": 0, "translation": [10, 0, 0]}]`, 1)
+	m := New()
+	if err := m.Load(strings.NewReader(js)); err != nil {
+		t.Fatal(err)
+	}
+	if min, max := m.Bounds(); min != [3]float32{10, 0, 0} || max != [3]float32{11, 1, 0} {
+		t.Errorf("got bounds %v - %v, want the node's [10 0 0] - [11 1 0]", min, max)
+	}
+}
@@ -0,0 +1,508 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BuiltinPrefix starts the names of models generated rather than loaded,
+// such as "builtin:torus?segments=128&rings=64".
+const BuiltinPrefix = "builtin:"
+
+// builtins maps the name of each generated model to its generator.
+var builtins = map[string]func(b *builder, p *params){
+	"uvsphere":  uvSphere,
+	"icosphere": icoSphere,
+	"torus":     torus,
+	"cube":      cube,
+	"cylinder":  cylinder,
+	"cone":      cone,
+	"plane":     plane,
+	"teapot":    teapot,
+}
+
+// Builtins returns the names of the generated models.
+func Builtins() []string {
+	var names []string
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadBuiltin generates the model named by spec, a name optionally followed
+// by a query string of parameters.
+func (m *Model) loadBuiltin(spec string) error {
+	name, query := spec, ""
+	if i := strings.IndexByte(spec, '?'); i >= 0 {
+		name, query = spec[:i], spec[i+1:]
+	}
+	gen, ok := builtins[name]
+	if !ok {
+		return fmt.Errorf("unknown builtin model: %s (expected one of %s)", name, strings.Join(Builtins(), ", "))
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("invalid parameters for %s: %s", name, err)
+	}
+
+	*m = New()
+	m.Format = BuiltinPrefix + name
+	b := &builder{m: m, index: make(map[[VertexSize]float32]uint32)}
+	p := &params{values: values, used: make(map[string]bool)}
+	gen(b, p)
+	if err := p.check(); err != nil {
+		return fmt.Errorf("invalid parameters for %s: %s", name, err)
+	}
+
+	m.VertexCount = len(m.VertexData) / m.Stride
+	m.FaceCount = len(m.FaceData) / 3
+	m.Polygons = polygonCounts(b.polygons)
+	m.HasNormals = true
+	m.HasTexCoords = true
+	m.GenerateTangents()
+	return nil
+}
+
+// params holds the parameters given to a generator, and the first problem
+// found reading them.
+type params struct {
+	values url.Values
+	used   map[string]bool
+	err    error
+}
+
+// Limits of the parameters of generators, keeping the models they make to a
+// size that can be drawn.
+const (
+	maxSegments     = 1024
+	maxSubdivisions = 8
+	maxSize         = 1e6
+)
+
+// int returns the named parameter, which must be from min to max.
+func (p *params) int(name string, def, min, max int) int {
+	p.used[name] = true
+	s := p.values.Get(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		if p.err == nil {
+			p.err = fmt.Errorf("%s must be an integer from %d to %d", name, min, max)
+		}
+		return def
+	}
+	return v
+}
+
+// float returns the named parameter, which must be positive and at most
+// max.
+func (p *params) float(name string, def, max float64) float64 {
+	p.used[name] = true
+	s := p.values.Get(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(v > 0) || v > max {
+		if p.err == nil {
+			p.err = fmt.Errorf("%s must be a positive number of at most %g", name, max)
+		}
+		return def
+	}
+	return v
+}
+
+// check returns the first problem found, including parameters the
+// generator does not use.
+func (p *params) check() error {
+	if p.err != nil {
+		return p.err
+	}
+	for name := range p.values {
+		if !p.used[name] {
+			return fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+	return nil
+}
+
+// builder adds triangles to a model, sharing identical vertices.
+type builder struct {
+	m        *Model
+	index    map[[VertexSize]float32]uint32
+	polygons []int // Vertices of each polygon added.
+}
+
+// vertex describes a generated vertex.
+type vertex struct {
+	p, n [3]float64
+	uv   [2]float64
+}
+
+func (b *builder) vertex(v vertex) uint32 {
+	var data [VertexSize]float32
+	for k := 0; k < 3; k++ {
+		data[PositionOffset+k] = float32(v.p[k])
+		data[NormalOffset+k] = float32(v.n[k])
+	}
+	data[TexCoordOffset] = float32(v.uv[0])
+	data[TexCoordOffset+1] = float32(v.uv[1])
+	if i, ok := b.index[data]; ok {
+		return i
+	}
+	i := uint32(len(b.m.VertexData) / b.m.Stride)
+	b.m.VertexData = append(b.m.VertexData, data[:]...)
+	b.index[data] = i
+	return i
+}
+
+// triangle adds a triangle, wound counterclockwise when seen from the side
+// its normals face, and reports whether it did.  Triangles with no area,
+// such as those at the poles of a sphere, are dropped.
+func (b *builder) triangle(v0, v1, v2 vertex) bool {
+	e1 := [3]float64{v1.p[0] - v0.p[0], v1.p[1] - v0.p[1], v1.p[2] - v0.p[2]}
+	e2 := [3]float64{v2.p[0] - v0.p[0], v2.p[1] - v0.p[1], v2.p[2] - v0.p[2]}
+	n := [3]float64{e1[1]*e2[2] - e1[2]*e2[1], e1[2]*e2[0] - e1[0]*e2[2], e1[0]*e2[1] - e1[1]*e2[0]}
+	area := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	if area < 1e-12 {
+		return false
+	}
+	var facing float64
+	for k := 0; k < 3; k++ {
+		facing += n[k] * (v0.n[k] + v1.n[k] + v2.n[k])
+	}
+	if facing < 0 {
+		v1, v2 = v2, v1
+	}
+	b.m.FaceData = append(b.m.FaceData, b.vertex(v0), b.vertex(v1), b.vertex(v2))
+	b.polygons = append(b.polygons, 3)
+	return true
+}
+
+// quad adds the quad v0 v1 v2 v3 as two triangles, kept as one polygon
+// unless either is dropped.
+func (b *builder) quad(v0, v1, v2, v3 vertex) {
+	first, second := b.triangle(v0, v1, v2), b.triangle(v0, v2, v3)
+	if first && second {
+		b.polygons = append(b.polygons[:len(b.polygons)-2], 4)
+	}
+}
+
+// grid adds a surface of cols by rows quads, with f giving the vertex at
+// each (s, t) in [0, 1].  Texture coordinates default to (s, t).
+func (b *builder) grid(cols, rows int, f func(s, t float64) vertex) {
+	vs := make([]vertex, (cols+1)*(rows+1))
+	for j := 0; j <= rows; j++ {
+		for i := 0; i <= cols; i++ {
+			s, t := float64(i)/float64(cols), float64(j)/float64(rows)
+			v := f(s, t)
+			if v.uv == [2]float64{} {
+				v.uv = [2]float64{s, t}
+			}
+			vs[j*(cols+1)+i] = v
+		}
+	}
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			a, c := j*(cols+1)+i, (j+1)*(cols+1)+i
+			b.quad(vs[a], vs[a+1], vs[c+1], vs[c])
+		}
+	}
+}
+
+// lathe adds the surface made by rotating a profile, giving the radius and
+// height at each t in [0, 1], about the Y axis.
+func (b *builder) lathe(segments, rows int, profile func(t float64) (r, y float64)) {
+	const dt = 1e-4
+	b.grid(segments, rows, func(s, t float64) vertex {
+		r, y := profile(t)
+		r0, y0 := profile(math.Max(t-dt, 0))
+		r1, y1 := profile(math.Min(t+dt, 1))
+		nr, ny := normalize2(y1-y0, -(r1 - r0))
+		c, sn := turn(s)
+		sn = -sn
+		return vertex{
+			p: [3]float64{r * c, y, r * sn},
+			n: [3]float64{nr * c, ny, nr * sn},
+		}
+	})
+}
+
+// disc adds a flat disc of the given radius at height y, facing up or down.
+func (b *builder) disc(segments int, radius, y float64, up bool) {
+	ny := -1.0
+	if up {
+		ny = 1
+	}
+	b.grid(segments, 1, func(s, t float64) vertex {
+		c, sn := turn(s)
+		x, z := t*c, -t*sn
+		return vertex{
+			p:  [3]float64{radius * x, y, radius * z},
+			n:  [3]float64{0, ny, 0},
+			uv: [2]float64{0.5 + 0.5*x, 0.5 - 0.5*z*ny},
+		}
+	})
+}
+
+// sweep adds a tube around a path in the XY plane, giving the center and
+// radius of the tube at each t in [0, 1].
+func (b *builder) sweep(segments, rows int, path func(t float64) (x, y, r float64)) {
+	const dt = 1e-4
+	b.grid(rows, segments, func(s, t float64) vertex {
+		x, y, r := path(s)
+		x0, y0, _ := path(math.Max(s-dt, 0))
+		x1, y1, _ := path(math.Min(s+dt, 1))
+		tx, ty := normalize2(x1-x0, y1-y0)
+		c, sn := turn(t)
+		n := [3]float64{-ty * c, tx * c, sn}
+		return vertex{
+			p: [3]float64{x + r*n[0], y + r*n[1], r * n[2]},
+			n: n,
+		}
+	})
+}
+
+// turn returns the cosine and sine of s full turns, exactly 0 or 1 at
+// multiples of a quarter turn so the ends of closed surfaces meet.
+func turn(s float64) (float64, float64) {
+	sn, c := math.Sincos(2 * math.Pi * s)
+	if math.Abs(c) < 1e-12 {
+		c = 0
+	}
+	if math.Abs(sn) < 1e-12 {
+		sn = 0
+	}
+	return c, sn
+}
+
+func normalize2(x, y float64) (float64, float64) {
+	l := math.Hypot(x, y)
+	if l == 0 {
+		return 0, 0
+	}
+	return x / l, y / l
+}
+
+func uvSphere(b *builder, p *params) {
+	segments := p.int("segments", 32, 3, maxSegments)
+	rings := p.int("rings", 16, 2, maxSegments)
+	radius := p.float("radius", 1, maxSize)
+	b.grid(segments, rings, func(s, t float64) vertex {
+		ct, st := turn((1 - t) / 2)
+		cp, sp := turn(s)
+		n := [3]float64{st * cp, ct, -st * sp}
+		return vertex{p: [3]float64{radius * n[0], radius * n[1], radius * n[2]}, n: n}
+	})
+}
+
+func icoSphere(b *builder, p *params) {
+	subdivisions := p.int("subdivisions", 3, 0, maxSubdivisions)
+	radius := p.float("radius", 1, maxSize)
+
+	g := (1 + math.Sqrt(5)) / 2
+	points := [][3]float64{
+		{-1, g, 0}, {1, g, 0}, {-1, -g, 0}, {1, -g, 0},
+		{0, -1, g}, {0, 1, g}, {0, -1, -g}, {0, 1, -g},
+		{g, 0, -1}, {g, 0, 1}, {-g, 0, -1}, {-g, 0, 1},
+	}
+	faces := [][3]int{
+		{0, 11, 5}, {0, 5, 1}, {0, 1, 7}, {0, 7, 10}, {0, 10, 11},
+		{1, 5, 9}, {5, 11, 4}, {11, 10, 2}, {10, 7, 6}, {7, 1, 8},
+		{3, 9, 4}, {3, 4, 2}, {3, 2, 6}, {3, 6, 8}, {3, 8, 9},
+		{4, 9, 5}, {2, 4, 11}, {6, 2, 10}, {8, 6, 7}, {9, 8, 1},
+	}
+	for i := range points {
+		points[i] = unit(points[i])
+	}
+	for i := 0; i < subdivisions; i++ {
+		mid := make(map[[2]int]int)
+		midpoint := func(a, c int) int {
+			key := [2]int{a, c}
+			if a > c {
+				key = [2]int{c, a}
+			}
+			if m, ok := mid[key]; ok {
+				return m
+			}
+			pa, pc := points[a], points[c]
+			points = append(points, unit([3]float64{pa[0] + pc[0], pa[1] + pc[1], pa[2] + pc[2]}))
+			mid[key] = len(points) - 1
+			return len(points) - 1
+		}
+		var next [][3]int
+		for _, f := range faces {
+			a, c, d := midpoint(f[0], f[1]), midpoint(f[1], f[2]), midpoint(f[2], f[0])
+			next = append(next, [3]int{f[0], a, d}, [3]int{f[1], c, a}, [3]int{f[2], d, c}, [3]int{a, c, d})
+		}
+		faces = next
+	}
+
+	// Texture coordinates wrap around the Y axis.  Triangles crossing the
+	// seam have their coordinates unwrapped, and vertices at the poles take
+	// the coordinate of the rest of their triangle.
+	for _, f := range faces {
+		var vs [3]vertex
+		for k, i := range f {
+			n := points[i]
+			vs[k] = vertex{
+				p:  [3]float64{radius * n[0], radius * n[1], radius * n[2]},
+				n:  n,
+				uv: [2]float64{0.5 + math.Atan2(-n[2], n[0])/(2*math.Pi), 0.5 + math.Asin(n[1])/math.Pi},
+			}
+		}
+		for k := range vs {
+			if vs[k].uv[0] < 0.25 && (vs[(k+1)%3].uv[0] > 0.75 || vs[(k+2)%3].uv[0] > 0.75) {
+				vs[k].uv[0]++
+			}
+		}
+		for k := range vs {
+			if math.Abs(vs[k].n[1]) > 1-1e-9 {
+				vs[k].uv[0] = (vs[(k+1)%3].uv[0] + vs[(k+2)%3].uv[0]) / 2
+			}
+		}
+		b.triangle(vs[0], vs[1], vs[2])
+	}
+}
+
+func unit(v [3]float64) [3]float64 {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
+
+func torus(b *builder, p *params) {
+	segments := p.int("segments", 48, 3, maxSegments)
+	rings := p.int("rings", 24, 3, maxSegments)
+	radius := p.float("radius", 1, maxSize)
+	tube := p.float("tube", 0.25, maxSize)
+	b.grid(segments, rings, func(s, t float64) vertex {
+		cu, su := turn(s)
+		cv, sv := turn(t)
+		n := [3]float64{cv * cu, sv, -cv * su}
+		c := [3]float64{radius * cu, 0, -radius * su}
+		return vertex{p: [3]float64{c[0] + tube*n[0], tube * n[1], c[2] + tube*n[2]}, n: n}
+	})
+}
+
+func cube(b *builder, p *params) {
+	segments := p.int("segments", 1, 1, maxSegments)
+	size := p.float("size", 2, maxSize)
+	h := size / 2
+	// Each face is given by its normal and the directions of s and t.
+	faces := [][3][3]float64{
+		{{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+		{{-1, 0, 0}, {0, 0, 1}, {0, 1, 0}},
+		{{0, 1, 0}, {1, 0, 0}, {0, 0, -1}},
+		{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}},
+		{{0, 0, 1}, {1, 0, 0}, {0, 1, 0}},
+		{{0, 0, -1}, {-1, 0, 0}, {0, 1, 0}},
+	}
+	for _, f := range faces {
+		n, du, dv := f[0], f[1], f[2]
+		b.grid(segments, segments, func(s, t float64) vertex {
+			var v vertex
+			for k := 0; k < 3; k++ {
+				v.p[k] = h * (n[k] + (2*s-1)*du[k] + (2*t-1)*dv[k])
+			}
+			v.n = n
+			return v
+		})
+	}
+}
+
+func cylinder(b *builder, p *params) {
+	segments := p.int("segments", 32, 3, maxSegments)
+	rings := p.int("rings", 1, 1, maxSegments)
+	radius := p.float("radius", 1, maxSize)
+	height := p.float("height", 2, maxSize)
+	b.lathe(segments, rings, func(t float64) (float64, float64) {
+		return radius, height * (t - 0.5)
+	})
+	b.disc(segments, radius, height/2, true)
+	b.disc(segments, radius, -height/2, false)
+}
+
+func cone(b *builder, p *params) {
+	segments := p.int("segments", 32, 3, maxSegments)
+	rings := p.int("rings", 1, 1, maxSegments)
+	radius := p.float("radius", 1, maxSize)
+	height := p.float("height", 2, maxSize)
+	b.lathe(segments, rings, func(t float64) (float64, float64) {
+		return radius * (1 - t), height * (t - 0.5)
+	})
+	b.disc(segments, radius, -height/2, false)
+}
+
+func plane(b *builder, p *params) {
+	segments := p.int("segments", 1, 1, maxSegments)
+	size := p.float("size", 2, maxSize)
+	b.grid(segments, segments, func(s, t float64) vertex {
+		return vertex{
+			p: [3]float64{size * (s - 0.5), 0, size * (0.5 - t)},
+			n: [3]float64{0, 1, 0},
+		}
+	})
+}
+
+// teapot approximates the classic test shape with a body and lid turned on
+// a lathe, a handle and a spout.
+func teapot(b *builder, p *params) {
+	segments := p.int("segments", 32, 3, maxSegments)
+	rows := segments / 2
+	if rows < 2 {
+		rows = 2
+	}
+
+	// Body, bulging out from a flat base up to the rim.
+	b.lathe(segments, rows, func(t float64) (float64, float64) {
+		return 0.75 + 0.45*math.Sin(0.9*math.Pi*t), 1.3 * t
+	})
+	b.disc(segments, 0.75, 0, false)
+
+	// Lid, a dome on the rim topped by a knob.
+	rim := 0.75 + 0.45*math.Sin(0.9*math.Pi)
+	b.lathe(segments, rows/2+1, func(t float64) (float64, float64) {
+		c, sn := turn(t / 4)
+		return rim * c, 1.3 + 0.3*sn
+	})
+	b.lathe(segments, rows/2+1, func(t float64) (float64, float64) {
+		c, sn := turn((t - 0.5) / 2)
+		return 0.12 * c, 1.72 + 0.12*sn
+	})
+
+	// Handle, an arc on the -X side.
+	b.sweep(segments/2, segments, func(t float64) (float64, float64, float64) {
+		a := -1.3 + 2.6*t
+		return -1.0 - 0.45*math.Cos(a), 0.7 + 0.45*math.Sin(a), 0.08
+	})
+
+	// Spout, curving up from the +X side and narrowing to its tip.
+	b.sweep(segments/2, segments, func(t float64) (float64, float64, float64) {
+		u := 1 - t
+		x := u*u*0.9 + 2*u*t*1.6 + t*t*1.75
+		y := u*u*0.35 + 2*u*t*0.4 + t*t*1.15
+		return x, y, 0.2 - 0.12*t
+	})
+}
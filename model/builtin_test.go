@@ -0,0 +1,69 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestBuiltinParameters(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"torus", true},
+		{"torus?segments=1024&rings=3", true},
+		{"torus?segments=1025", false},
+		{"torus?rings=2", false},
+		{"torus?segments=-1", false},
+		{"torus?tube=1e6", true},
+		{"torus?tube=1e7", false},
+		{"torus?radius=inf", false},
+		{"torus?radius=0", false},
+		{"icosphere?subdivisions=5", true},
+		{"icosphere?subdivisions=9", false},
+		{"cube?segments=999999999999", false},
+		{"cube?twist=1", false},
+	}
+	for _, test := range tests {
+		m := New()
+		err := m.LoadFile(BuiltinPrefix + test.spec)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: got error %v, want success %t", test.spec, err, test.ok)
+		}
+		if err == nil && m.FaceCount == 0 {
+			t.Errorf("%s: generated no faces", test.spec)
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	closed := map[string]bool{"cone": true, "cube": true, "cylinder": true, "icosphere": true, "torus": true, "uvsphere": true}
+	for _, name := range Builtins() {
+		m := New()
+		if err := m.LoadFile(BuiltinPrefix + name); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !m.HasNormals || !m.HasTexCoords || !m.HasTangents {
+			t.Errorf("%s: got normals %t, texture coordinates %t, tangents %t, want all", name, m.HasNormals, m.HasTexCoords, m.HasTangents)
+		}
+		s := m.Stats()
+		if s.OutOfRangeIndices > 0 || s.DegenerateTriangles > 0 || s.ZeroLengthNormals > 0 {
+			t.Errorf("%s: got %d out of range indices, %d degenerate triangles and %d zero length normals", name, s.OutOfRangeIndices, s.DegenerateTriangles, s.ZeroLengthNormals)
+		}
+		if closed[name] && (s.BoundaryEdges > 0 || s.NonManifoldEdges > 0) {
+			t.Errorf("%s: got %d boundary and %d non-manifold edges, want a closed surface", name, s.BoundaryEdges, s.NonManifoldEdges)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ParseError reports where a problem was found while reading a model.
+type ParseError struct {
+	File     string // Filename, set by LoadFile.
+	Format   string // Format being read, such as "ply" or "obj".
+	Offset   int64  // Byte offset of the problem, -1 if unknown.
+	Line     int    // Line of the problem, 0 for binary data.
+	Element  string // Element, statement or object being read.
+	Index    int    // Index of the item within Element, -1 if none.
+	Property string // Property or attribute being read.
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	msg := e.File
+	if msg == "" {
+		msg = e.Format
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(":%d", e.Line)
+	}
+	if e.Offset >= 0 {
+		msg += fmt.Sprintf(" (offset %d)", e.Offset)
+	}
+	where := e.Element
+	if e.Element != "" && e.Index >= 0 {
+		where += fmt.Sprintf(" %d", e.Index)
+	}
+	if e.Property != "" {
+		where = strings.TrimSpace(where + " " + e.Property)
+	}
+	if where != "" {
+		msg += ": " + where
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// finite returns an error if v is NaN or infinite.
+func finite(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%v is not a finite value", v)
+	}
+	return nil
+}
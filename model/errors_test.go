@@ -0,0 +1,253 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const plyTriangle = `ply
+format ascii 1.0
+element vertex 3
+property float x
+property float y
+property float z
+element face 1
+property list uchar int vertex_indices
+end_header
+`
+
+// gltfTriangle returns the JSON of a glTF file holding a triangle with the
+// given indices, and its buffer.  Without a uri the buffer is expected in
+// the binary chunk of a GLB container.
+func gltfTriangle(indices []uint16, uri bool) (string, []byte) {
+	var buf bytes.Buffer
+	for _, v := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		binary.Write(&buf, binary.LittleEndian, math.Float32bits(v))
+	}
+	binary.Write(&buf, binary.LittleEndian, indices)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	buffer := fmt.Sprintf(`{"byteLength": %d}`, buf.Len())
+	if uri {
+		buffer = fmt.Sprintf(`{"uri": "data:application/octet-stream;base64,%s", "byteLength": %d}`,
+			base64.StdEncoding.EncodeToString(buf.Bytes()), buf.Len())
+	}
+	js := fmt.Sprintf(`{
+  "asset": {"version": "2.0"},
+  "buffers": [%s],
+  "bufferViews": [
+    {"buffer": 0, "byteLength": 36},
+    {"buffer": 0, "byteOffset": 36, "byteLength": %d}
+  ],
+  "accessors": [
+    {"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+    {"bufferView": 1, "componentType": 5123, "count": %d, "type": "SCALAR"}
+  ],
+  "meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "indices": 1}]}],
+  "nodes": [{"mesh": 0}],
+  "scenes": [{"nodes": [0]}]
+}`, buffer, 2*len(indices), len(indices))
+	return js, buf.Bytes()
+}
+
+// glbTriangle returns a GLB container holding a triangle with the given
+// indices.
+func glbTriangle(indices []uint16) []byte {
+	js, bin := gltfTriangle(indices, false)
+	for len(js)%4 != 0 {
+		js += " "
+	}
+	var buf bytes.Buffer
+	buf.WriteString("glTF")
+	binary.Write(&buf, binary.LittleEndian, []uint32{2, uint32(12 + 8 + len(js) + 8 + len(bin))})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(js)), 0x4e4f534a})
+	buf.WriteString(js)
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004e4942})
+	buf.Write(bin)
+	return buf.Bytes()
+}
+
+// loadBytes writes data to a file with the given name and loads it.
+func loadBytes(t *testing.T, name string, data []byte) (string, error) {
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	return filename, m.LoadFile(filename)
+}
+
+func TestLoadErrors(t *testing.T) {
+	binaryPLY := strings.Replace(plyTriangle, "ascii", "binary_little_endian", 1)
+	binarySTL := make([]byte, 84+50)
+	copy(binarySTL, "binary")
+	binarySTL[80] = 2
+	gltfIndices, _ := gltfTriangle([]uint16{0, 1, 5}, true)
+	gltfData, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	glb := glbTriangle([]uint16{0, 1, 2})
+
+	tests := []struct {
+		name string
+		data string
+		want ParseError
+	}{
+		{"truncated.ply", plyTriangle + "0 0 0\n1 0 0\n",
+			ParseError{Format: "ply", Offset: 166, Line: 11, Element: "vertex", Index: 2}},
+		{"corrupt.ply", plyTriangle + "0 0 0\n1 x 0\n0 1 0\n3 0 1 2\n",
+			ParseError{Format: "ply", Offset: 160, Line: 11, Element: "vertex", Index: 1, Property: "y"}},
+		{"range.ply", plyTriangle + "0 0 0\n1 0 0\n0 1 0\n3 0 1 7\n",
+			ParseError{Format: "ply", Offset: 172, Line: 13, Element: "face", Index: 0, Property: "vertex_indices"}},
+		{"truncated_binary.ply", binaryPLY + strings.Repeat("\x00", 10),
+			ParseError{Format: "ply", Offset: 177, Element: "vertex", Index: 0, Property: "z"}},
+		{"range_binary.ply", binaryPLY + strings.Repeat("\x00", 36) + "\x03\x00\x00\x00\x00\x01\x00\x00\x00\x09\x00\x00\x00",
+			ParseError{Format: "ply", Offset: 214, Element: "face", Index: 0, Property: "vertex_indices"}},
+		{"huge_vertices.ply", strings.Replace(plyTriangle, "vertex 3", "vertex 4000000000", 1) + "0 0 0\n",
+			ParseError{Format: "ply", Offset: 21, Line: 3, Element: "vertex", Index: -1}},
+		{"huge_faces.ply", strings.Replace(plyTriangle, "face 1", "face 2000000000", 1) + "0 0 0\n1 0 0\n0 1 0\n3 0 1 2\n",
+			ParseError{Format: "ply", Offset: 189, Line: 13, Element: "face", Index: 1}},
+		{"huge_binary.ply", strings.Replace(binaryPLY, "vertex 3", "vertex 2000000000", 1) + "\x00\x00",
+			ParseError{Format: "ply", Offset: 178, Element: "vertex", Index: 0, Property: "x"}},
+		{"corrupt.obj", "v 0 0 0\nv 1 x 0\n",
+			ParseError{Format: "obj", Offset: 8, Line: 2, Element: "v", Index: -1}},
+		{"range.obj", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 9\n",
+			ParseError{Format: "obj", Offset: 24, Line: 4, Element: "f", Index: -1}},
+		{"corrupt.stl", "solid t\nfacet normal 0 0 1\nouter loop\nvertex 0 0 q\n",
+			ParseError{Format: "stl", Offset: 38, Line: 4, Element: "facet", Index: 0, Property: "vertex"}},
+		{"truncated.stl", "solid t\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\n",
+			ParseError{Format: "stl", Offset: 49, Line: 4, Element: "facet", Index: 0}},
+		{"endfacet.stl", "solid t\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nendloop\nendfacet\nendfacet\n",
+			ParseError{Format: "stl", Offset: 94, Line: 9, Element: "facet", Index: 1}},
+		{"truncated_binary.stl", string(binarySTL),
+			ParseError{Format: "stl", Offset: 134, Element: "facet", Index: 1}},
+		{"corrupt.gltf", `{"asset": {"version": "2.0"},` + "\n" + `"meshes": [}`,
+			ParseError{Format: "gltf", Offset: 42, Line: 2, Index: -1}},
+		{"truncated.gltf", gltfData[:200],
+			ParseError{Format: "gltf", Offset: 200, Line: 5, Index: -1}},
+		{"range.gltf", gltfIndices,
+			ParseError{Format: "gltf", Offset: -1, Element: "mesh 0 primitive", Index: 0, Property: "indices"}},
+		{"truncated_header.glb", string(glb[:10]),
+			ParseError{Format: "glb", Offset: 0, Index: -1}},
+		{"truncated.glb", string(glb[:40]),
+			ParseError{Format: "glb", Offset: 12, Index: -1}},
+		{"range.glb", string(glbTriangle([]uint16{0, 3, 2})),
+			ParseError{Format: "glb", Offset: -1, Element: "mesh 0 primitive", Index: 0, Property: "indices"}},
+	}
+	for _, test := range tests {
+		filename, err := loadBytes(t, test.name, []byte(test.data))
+		var e *ParseError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got error %v, want a ParseError", test.name, err)
+			continue
+		}
+		want := test.want
+		want.File, want.Err = filename, e.Err
+		if *e != want {
+			t.Errorf("%s: got %+v, want %+v", test.name, *e, want)
+		}
+	}
+}
+
+// TestGLTFAccessorBounds loads glTF files whose accessors or buffer views
+// have negative or oversized counts, offsets and strides, which must be
+// rejected before any elements are read.
+func TestGLTFAccessorBounds(t *testing.T) {
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	positions := `{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}`
+	indices := `{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"}`
+	view := `{"buffer": 0, "byteLength": 36}`
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"negative count", positions, strings.Replace(positions, `"count": 3`, `"count": -1`, 1), "negative count or offset"},
+		{"huge count", positions, strings.Replace(positions, `"count": 3`, `"count": 1000000000000`, 1), "exceeds its buffer view"},
+		{"negative offset", positions, strings.Replace(positions, `"count"`, `"byteOffset": -12, "count"`, 1), "negative count or offset"},
+		{"huge offset", positions, strings.Replace(positions, `"count"`, `"byteOffset": 1000000000000, "count"`, 1), "exceeds its buffer view"},
+		{"negative stride", view, strings.Replace(view, `}`, `, "byteStride": -12}`, 1), "negative stride"},
+		{"huge stride", view, strings.Replace(view, `}`, `, "byteStride": 1000000000000}`, 1), "exceeds its buffer view"},
+		{"negative index count", indices, strings.Replace(indices, `"count": 3`, `"count": -3`, 1), "exceeds its buffer view"},
+		{"huge index count", indices, strings.Replace(indices, `"count": 3`, `"count": 1000000000000`, 1), "exceeds its buffer view"},
+		{"negative index offset", indices, strings.Replace(indices, `"count"`, `"byteOffset": -2, "count"`, 1), "exceeds its buffer view"},
+	}
+	for _, test := range tests {
+		data := strings.Replace(js, test.old, test.new, 1)
+		if data == js {
+			t.Fatalf("%s: accessor not found in %s", test.name, js)
+		}
+		_, err := loadBytes(t, "accessor.gltf", []byte(data))
+		var e *ParseError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got error %v, want a ParseError", test.name, err)
+			continue
+		}
+		if !strings.Contains(e.Err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+// TestLoadTruncated loads every prefix of valid files, which must either
+// load or fail with a ParseError.
+func TestLoadTruncated(t *testing.T) {
+	m := savedModel()
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	files := map[string][]byte{
+		"tri.gltf": []byte(js),
+		"tri.glb":  glbTriangle([]uint16{0, 1, 2}),
+	}
+	for _, f := range []struct {
+		name   string
+		encode EncodeFunc
+		ascii  bool
+	}{
+		{"ascii.ply", encodePLY, true},
+		{"binary.ply", encodePLY, false},
+		{"quad.obj", encodeOBJ, true},
+		{"ascii.stl", encodeSTL, true},
+		{"binary.stl", encodeSTL, false},
+	} {
+		var buf bytes.Buffer
+		if err := f.encode(m, &buf, f.ascii); err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		files[f.name] = buf.Bytes()
+	}
+
+	for name, data := range files {
+		if _, err := loadBytes(t, name, data); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		for n := 0; n < len(data); n++ {
+			_, err := loadBytes(t, name, data[:n])
+			var e *ParseError
+			if err != nil && !errors.As(err, &e) {
+				t.Errorf("%s cut to %d bytes: got error %v, want a ParseError", name, n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// DecodeFunc reads a model from r into m, following the options it is
+// loaded with.  Files referenced by the model, such as material libraries,
+// are resolved relative to dir.
+type DecodeFunc func(m *Model, r io.Reader, dir string, opts LoadOptions) error
+
+// EncodeFunc writes m to w.  Formats with both a text and a binary
+// encoding use the text one when ascii is set.
+type EncodeFunc func(m Model, w io.Writer, ascii bool) error
+
+type format struct {
+	name   string
+	exts   []string
+	magic  string
+	decode DecodeFunc
+	detect func(r *bufio.Reader) bool // Identifies data without magic, nil if none.
+}
+
+type encoder struct {
+	name   string
+	exts   []string
+	encode EncodeFunc
+}
+
+// readBufferSize is the size of the buffer models are read through.
+const readBufferSize = 64 << 10
+
+var formats []format
+var encoders []encoder
+
+// RegisterFormat registers a model format for use by Load and LoadFile.
+// Exts are the file extensions, including the leading dot, the format is
+// stored with.  Magic is the prefix identifying the encoded data, formats
+// without one are only tried when no other format matches.
+func RegisterFormat(name string, exts []string, magic string, decode DecodeFunc) {
+	formats = append(formats, format{name: name, exts: exts, magic: magic, decode: decode})
+}
+
+// registerDetector sets the function identifying data of the named format
+// that has no magic, tried when no format's magic matches.
+func registerDetector(name string, detect func(r *bufio.Reader) bool) {
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].detect = detect
+		}
+	}
+}
+
+// RegisterEncoder registers a model format for use by SaveFile.  Exts are
+// the file extensions, including the leading dot, the format is written for.
+func RegisterEncoder(name string, exts []string, encode EncodeFunc) {
+	encoders = append(encoders, encoder{name, exts, encode})
+}
+
+func encoderByExt(ext string) (encoder, bool) {
+	for _, e := range encoders {
+		for _, x := range e.exts {
+			if strings.EqualFold(x, ext) {
+				return e, true
+			}
+		}
+	}
+	return encoder{}, false
+}
+
+func formatByExt(ext string) (format, bool) {
+	for _, f := range formats {
+		for _, e := range f.exts {
+			if strings.EqualFold(e, ext) {
+				return f, true
+			}
+		}
+	}
+	return format{}, false
+}
+
+// sniff returns the format matching the leading bytes of r.
+func sniff(r *bufio.Reader) (format, error) {
+	var fallback *format
+	for i, f := range formats {
+		if f.magic == "" {
+			if fallback == nil {
+				fallback = &formats[i]
+			}
+			continue
+		}
+		b, err := r.Peek(len(f.magic))
+		if err == nil && string(b) == f.magic {
+			return f, nil
+		}
+	}
+	for _, f := range formats {
+		if f.detect != nil && f.detect(r) {
+			return f, nil
+		}
+	}
+	if fallback == nil {
+		return format{}, fmt.Errorf("unknown model format")
+	}
+	return *fallback, nil
+}
+
+// LoadOptions control how model files are read.
+type LoadOptions struct {
+	// Workers is the number of goroutines parsing large text files, or 0
+	// for one per CPU.
+	Workers int
+	// Progress, if set, is called as the file is read with the number of
+	// bytes read so far and the size of the file, or -1 if it is unknown.
+	Progress func(read, size int64)
+
+	// The model read is converted as it is loaded: rotated from the Up
+	// axis to Y up, scaled by Scale, unless 0, and then transformed by
+	// Matrix, column-major, unless it is all zeros.
+	Up     UpAxis
+	Scale  float32
+	Matrix [16]float32
+	// FlipWinding reverses the winding of each triangle, for models whose
+	// front faces are wound clockwise.
+	FlipWinding bool
+	// TexCoords, unless NoProjection, replaces the texture coordinates of
+	// the model with ones projected from its positions, for models that
+	// have none.
+	TexCoords Projection
+	// FlipV flips texture coordinates vertically, for models whose
+	// texture origin is at the top left.
+	FlipV bool
+}
+
+func (o LoadOptions) workers() int {
+	if o.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Workers
+}
+
+// progressReader reports the data read from r as it is read.
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	size     int64
+	progress func(read, size int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.progress(p.read, p.size)
+	return n, err
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestFormatRegistry(t *testing.T) {
+	for ext, want := range map[string]string{".ply": "ply", ".OBJ": "obj", ".Stl": "stl", ".glb": "glb", ".gltf": "gltf"} {
+		if f, ok := formatByExt(ext); !ok || f.name != want {
+			t.Errorf("format for %s is %q, want %q", ext, f.name, want)
+		}
+	}
+	if f, ok := formatByExt(".txt"); ok {
+		t.Errorf("format for .txt is %q, want none", f.name)
+	}
+
+	// Data without magic falls back to OBJ, the first format without any.
+	for data, want := range map[string]string{
+		"ply\nformat ascii 1.0\n": "ply",
+		"glTF\x02\x00\x00\x00":    "glb",
+		`{"asset": {}}`:           "gltf",
+		"solid cube\n":            "stl",
+		"v 0 0 0\n":               "obj",
+	} {
+		f, err := sniff(bufio.NewReader(strings.NewReader(data)))
+		if err != nil || f.name != want {
+			t.Errorf("sniffed %q as %q, %v, want %q", data, f.name, err, want)
+		}
+	}
+}
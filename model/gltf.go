@@ -0,0 +1,1164 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+	RegisterFormat("glb", []string{".glb"}, "glTF", decodeGLTF)
+	RegisterFormat("gltf", []string{".gltf"}, "{", decodeGLTF)
+}
+
+const (
+	glbMagic     = 0x46546c67 // "glTF"
+	glbChunkJSON = 0x4e4f534a // "JSON"
+	glbChunkBIN  = 0x004e4942 // "BIN\x00"
+)
+
+// gltfDoc is the subset of a glTF 2.0 document used to build a Model.
+type gltfDoc struct {
+	Scene       *int             `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+	Materials   []gltfMaterial   `json:"materials"`
+	Textures    []gltfTexture    `json:"textures"`
+	Images      []gltfImage      `json:"images"`
+	Skins       []gltfSkin       `json:"skins"`
+	Animations  []gltfAnimation  `json:"animations"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string       `json:"name"`
+	Children    []int        `json:"children"`
+	Mesh        *int         `json:"mesh"`
+	Skin        *int         `json:"skin"`
+	Weights     []float32    `json:"weights"`
+	Matrix      *[16]float32 `json:"matrix"`
+	Translation *[3]float32  `json:"translation"`
+	Rotation    *[4]float32  `json:"rotation"`
+	Scale       *[3]float32  `json:"scale"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name"`
+	Primitives []gltfPrimitive `json:"primitives"`
+	Weights    []float32       `json:"weights"`
+	Extras     struct {
+		TargetNames []string `json:"targetNames"`
+	} `json:"extras"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int   `json:"attributes"`
+	Indices    *int             `json:"indices"`
+	Material   *int             `json:"material"`
+	Mode       *int             `json:"mode"`
+	Targets    []map[string]int `json:"targets"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int        `json:"bufferView"`
+	ByteOffset    int         `json:"byteOffset"`
+	ComponentType int         `json:"componentType"`
+	Normalized    bool        `json:"normalized"`
+	Count         int         `json:"count"`
+	Type          string      `json:"type"`
+	Sparse        *gltfSparse `json:"sparse"`
+}
+
+type gltfSparse struct {
+	Count   int `json:"count"`
+	Indices struct {
+		BufferView    int `json:"bufferView"`
+		ByteOffset    int `json:"byteOffset"`
+		ComponentType int `json:"componentType"`
+	} `json:"indices"`
+	Values struct {
+		BufferView int `json:"bufferView"`
+		ByteOffset int `json:"byteOffset"`
+	} `json:"values"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type gltfMaterial struct {
+	Name                 string `json:"name"`
+	PBRMetallicRoughness struct {
+		BaseColorTexture *gltfTextureRef `json:"baseColorTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture *gltfTextureRef `json:"normalTexture"`
+}
+
+type gltfTextureRef struct {
+	Index int `json:"index"`
+}
+
+type gltfTexture struct {
+	Source *int `json:"source"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+}
+
+type gltfSkin struct {
+	Name                string `json:"name"`
+	InverseBindMatrices *int   `json:"inverseBindMatrices"`
+	Joints              []int  `json:"joints"`
+}
+
+type gltfAnimation struct {
+	Name     string `json:"name"`
+	Channels []struct {
+		Sampler int `json:"sampler"`
+		Target  struct {
+			Node *int   `json:"node"`
+			Path string `json:"path"`
+		} `json:"target"`
+	} `json:"channels"`
+	Samplers []struct {
+		Input         int    `json:"input"`
+		Output        int    `json:"output"`
+		Interpolation string `json:"interpolation"`
+	} `json:"samplers"`
+}
+
+// componentSizes maps glTF accessor component types to their size in bytes.
+var componentSizes = map[int]int{
+	5120: 1, // BYTE
+	5121: 1, // UNSIGNED_BYTE
+	5122: 2, // SHORT
+	5123: 2, // UNSIGNED_SHORT
+	5125: 4, // UNSIGNED_INT
+	5126: 4, // FLOAT
+}
+
+// indexTypes are the component types allowed for indices.
+var indexTypes = map[int]bool{
+	5121: true, // UNSIGNED_BYTE
+	5123: true, // UNSIGNED_SHORT
+	5125: true, // UNSIGNED_INT
+}
+
+// maxZeroCount limits the elements of accessors with no buffer view, which
+// are zero but for any sparse values, as their count is not bounded by
+// the size of the file.
+const maxZeroCount = 1 << 24
+
+// typeComponents maps glTF accessor types to their number of components.
+var typeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+// gltfDecoder holds the state of a glTF file being read.
+type gltfDecoder struct {
+	m          *Model
+	dir        string
+	doc        gltfDoc
+	buffers    [][]byte
+	primitives map[[2]int]Group // First group read for each mesh primitive.
+	nodes      map[int]int      // Index into Nodes of each node read.
+}
+
+// decodeGLTF reads a glTF or GLB file.  Progress, if reported, is counted
+// by r as the file is read whole, leaving out buffers in other files.
+func decodeGLTF(m *Model, r io.Reader, dir string, opts LoadOptions) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	d := gltfDecoder{m: m, dir: dir, primitives: make(map[[2]int]Group), nodes: make(map[int]int)}
+	js, bin := data, []byte(nil)
+	var jsOffset int
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		m.Format = "glb"
+		if js, jsOffset, bin, err = splitGLB(data); err != nil {
+			return err
+		}
+	} else {
+		m.Format = "gltf"
+	}
+	if err := json.Unmarshal(js, &d.doc); err != nil {
+		return d.jsonError(data, jsOffset, err)
+	}
+
+	d.buffers = make([][]byte, len(d.doc.Buffers))
+	for i, b := range d.doc.Buffers {
+		if b.URI == "" {
+			if bin == nil {
+				return d.fail("buffer", i, "", fmt.Errorf("buffer has no data"))
+			}
+			d.buffers[i] = bin
+		} else if d.buffers[i], err = d.readURI(b.URI); err != nil {
+			return d.fail("buffer", i, "uri", err)
+		}
+		if len(d.buffers[i]) < b.ByteLength {
+			return d.fail("buffer", i, "", fmt.Errorf("buffer is %d bytes, expected %d", len(d.buffers[i]), b.ByteLength))
+		}
+	}
+
+	if err := d.readMaterials(); err != nil {
+		return err
+	}
+
+	m.HasNormals = true
+	m.HasTexCoords = true
+	m.HasTangents = true
+	for _, n := range d.roots() {
+		if err := d.readNode(n, -1, ident4(), 0); err != nil {
+			return err
+		}
+	}
+	m.VertexCount = len(m.VertexData) / m.Stride
+	m.FaceCount = len(m.FaceData) / 3
+	if err := d.readSkins(); err != nil {
+		return err
+	}
+	if err := d.readAnimations(); err != nil {
+		return err
+	}
+	if m.FaceCount == 0 {
+		m.HasNormals = false
+		m.HasTexCoords = false
+		m.HasTangents = false
+	}
+	return nil
+}
+
+// fail returns err as a ParseError for the named glTF object.
+func (d *gltfDecoder) fail(element string, index int, property string, err error) error {
+	return &ParseError{Format: d.m.Format, Offset: -1, Element: element, Index: index, Property: property, Err: err}
+}
+
+// jsonError returns err, from decoding the JSON starting at jsOffset in
+// data, as a ParseError.
+func (d *gltfDecoder) jsonError(data []byte, jsOffset int, err error) error {
+	e := &ParseError{Format: d.m.Format, Offset: -1, Index: -1, Err: err}
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		e.Offset = int64(jsOffset) + err.Offset
+	case *json.UnmarshalTypeError:
+		e.Offset = int64(jsOffset) + err.Offset
+		e.Property = err.Field
+	}
+	if e.Offset >= 0 && d.m.Format == "gltf" && e.Offset <= int64(len(data)) {
+		e.Line = bytes.Count(data[:e.Offset], []byte("\n")) + 1
+	}
+	return e
+}
+
+// splitGLB returns the JSON chunk of a GLB container, its offset, and the
+// binary chunk.
+func splitGLB(data []byte) ([]byte, int, []byte, error) {
+	fail := func(offset int, err error) ([]byte, int, []byte, error) {
+		return nil, 0, nil, &ParseError{Format: "glb", Offset: int64(offset), Index: -1, Err: err}
+	}
+	if len(data) < 12 {
+		return fail(0, fmt.Errorf("truncated glb header"))
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != 2 {
+		return fail(4, fmt.Errorf("unsupported glb version: %d", v))
+	}
+	if n := int(binary.LittleEndian.Uint32(data[8:])); n < len(data) {
+		data = data[:n]
+	}
+
+	var js, bin []byte
+	var jsOffset int
+	for off := 12; off+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[off:]))
+		t := binary.LittleEndian.Uint32(data[off+4:])
+		if n < 0 || off+8+n > len(data) {
+			return fail(off, fmt.Errorf("truncated glb chunk"))
+		}
+		off += 8
+		switch t {
+		case glbChunkJSON:
+			js, jsOffset = data[off:off+n], off
+		case glbChunkBIN:
+			if bin == nil {
+				bin = data[off : off+n]
+			}
+		}
+		off += n
+	}
+	if js == nil {
+		return fail(12, fmt.Errorf("glb has no json chunk"))
+	}
+	return js, jsOffset, bin, nil
+}
+
+// readURI returns the data referenced by a buffer or image URI.
+func (d *gltfDecoder) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		i := strings.IndexByte(uri, ',')
+		if i < 0 || !strings.HasSuffix(uri[:i], ";base64") {
+			return nil, fmt.Errorf("unsupported data uri")
+		}
+		return base64.StdEncoding.DecodeString(uri[i+1:])
+	}
+	return ioutil.ReadFile(d.path(uri))
+}
+
+func (d *gltfDecoder) path(uri string) string {
+	if p, err := url.PathUnescape(uri); err == nil {
+		uri = p
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(uri))
+}
+
+func (d *gltfDecoder) readMaterials() error {
+	for i, gm := range d.doc.Materials {
+		mat := Material{Name: gm.Name}
+		var err error
+		if ref := gm.PBRMetallicRoughness.BaseColorTexture; ref != nil {
+			if mat.ColorMap, mat.ColorMapData, err = d.texture(ref.Index); err != nil {
+				return d.fail("material", i, "baseColorTexture", err)
+			}
+		}
+		if ref := gm.NormalTexture; ref != nil {
+			if mat.NormalMap, mat.NormalMapData, err = d.texture(ref.Index); err != nil {
+				return d.fail("material", i, "normalTexture", err)
+			}
+		}
+		d.m.Materials = append(d.m.Materials, mat)
+	}
+	return nil
+}
+
+// texture returns the filename or, for embedded images, the data of the
+// image used by texture i.
+func (d *gltfDecoder) texture(i int) (string, []byte, error) {
+	if i < 0 || i >= len(d.doc.Textures) {
+		return "", nil, fmt.Errorf("texture %d out of range", i)
+	}
+	src := d.doc.Textures[i].Source
+	if src == nil {
+		return "", nil, nil
+	}
+	if *src < 0 || *src >= len(d.doc.Images) {
+		return "", nil, fmt.Errorf("image %d out of range", *src)
+	}
+	img := d.doc.Images[*src]
+	switch {
+	case img.BufferView != nil:
+		data, _, err := d.bufferView(*img.BufferView)
+		return "", data, err
+	case strings.HasPrefix(img.URI, "data:"):
+		data, err := d.readURI(img.URI)
+		return "", data, err
+	case img.URI != "":
+		return d.path(img.URI), nil, nil
+	}
+	return "", nil, nil
+}
+
+// roots returns the root nodes of the default scene.
+func (d *gltfDecoder) roots() []int {
+	if len(d.doc.Scenes) > 0 {
+		s := 0
+		if d.doc.Scene != nil && *d.doc.Scene >= 0 && *d.doc.Scene < len(d.doc.Scenes) {
+			s = *d.doc.Scene
+		}
+		return d.doc.Scenes[s].Nodes
+	}
+
+	// Without scenes, every node that is not a child is a root.
+	child := make([]bool, len(d.doc.Nodes))
+	for _, n := range d.doc.Nodes {
+		for _, c := range n.Children {
+			if c >= 0 && c < len(child) {
+				child[c] = true
+			}
+		}
+	}
+	var roots []int
+	for i := range d.doc.Nodes {
+		if !child[i] {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
+
+// readNode reads node i and its children, adding each to the nodes of the
+// model after its parent, the index of which is given.
+func (d *gltfDecoder) readNode(i, parentNode int, parent [16]float32, depth int) error {
+	if i < 0 || i >= len(d.doc.Nodes) {
+		return d.fail("node", i, "", fmt.Errorf("node out of range"))
+	}
+	if depth > len(d.doc.Nodes) {
+		return d.fail("node", i, "", fmt.Errorf("node is part of a cycle"))
+	}
+	n := d.doc.Nodes[i]
+	local := n.transform()
+	world := mul4(parent, local)
+	if err := finiteAll(world[:]); err != nil {
+		return d.fail("node", i, "transform", err)
+	}
+	node := Node{Name: n.Name, Parent: parentNode}
+	if n.Matrix != nil {
+		node.Translation, node.Rotation, node.Scale = decompose(local)
+	} else {
+		node.Translation, node.Rotation, node.Scale = trsOf(n)
+	}
+	self := len(d.m.Nodes)
+	d.nodes[i] = self
+	d.m.Nodes = append(d.m.Nodes, node)
+
+	if n.Mesh != nil {
+		if *n.Mesh < 0 || *n.Mesh >= len(d.doc.Meshes) {
+			return d.fail("node", i, "mesh", fmt.Errorf("mesh %d out of range", *n.Mesh))
+		}
+		g := Group{Name: d.doc.Meshes[*n.Mesh].Name, Material: -1, Transform: world, Skin: -1, Node: self}
+		if n.Skin != nil {
+			if *n.Skin < 0 || *n.Skin >= len(d.doc.Skins) {
+				return d.fail("node", i, "skin", fmt.Errorf("skin %d out of range", *n.Skin))
+			}
+			// Skinned meshes are placed by their joints alone.
+			g.Skin, g.Transform = *n.Skin, ident4()
+		}
+		if g.Name == "" {
+			g.Name = n.Name
+		}
+		g.FirstMorph, g.MorphCount = d.readMorphs(i)
+		for j, p := range d.doc.Meshes[*n.Mesh].Primitives {
+			if err := d.readPrimitive(g, *n.Mesh, j, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range n.Children {
+		if err := d.readNode(c, self, world, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transform returns the local transform of the node.
+func (n gltfNode) transform() [16]float32 {
+	if n.Matrix != nil {
+		return *n.Matrix
+	}
+	return trs(trsOf(n))
+}
+
+// trsOf returns the translation, rotation and scale of the node, which
+// animations replace.
+func trsOf(n gltfNode) (t [3]float32, q [4]float32, s [3]float32) {
+	t = [3]float32{0, 0, 0}
+	q = [4]float32{0, 0, 0, 1}
+	s = [3]float32{1, 1, 1}
+	if n.Translation != nil {
+		t = *n.Translation
+	}
+	if n.Rotation != nil {
+		q = *n.Rotation
+	}
+	if n.Scale != nil {
+		s = *n.Scale
+	}
+	return t, q, s
+}
+
+// readPrimitive adds a group drawing the primitive, set up as g is for the
+// node using the mesh.  Meshes used by several nodes share the vertices
+// read for the first.
+func (d *gltfDecoder) readPrimitive(g Group, mesh, prim int, p gltfPrimitive) error {
+	fail := func(property string, err error) error {
+		return d.fail(fmt.Sprintf("mesh %d primitive", mesh), prim, property, err)
+	}
+	g.First = len(d.m.FaceData) / 3
+	if p.Material != nil {
+		if *p.Material < 0 || *p.Material >= len(d.m.Materials) {
+			return fail("material", fmt.Errorf("material %d out of range", *p.Material))
+		}
+		g.Material = *p.Material
+	}
+
+	key := [2]int{mesh, prim}
+	if r, ok := d.primitives[key]; ok {
+		d.m.FaceData = append(d.m.FaceData, d.m.FaceData[3*r.First:3*(r.First+r.Count)]...)
+	} else if err := d.readTriangles(p, fail); err != nil {
+		return err
+	}
+	g.Count = len(d.m.FaceData)/3 - g.First
+	if _, ok := d.primitives[key]; !ok {
+		d.primitives[key] = g
+	}
+	if g.Count > 0 {
+		d.m.Groups = append(d.m.Groups, g)
+	}
+	return nil
+}
+
+// readTriangles adds the vertices and triangles of the primitive.
+func (d *gltfDecoder) readTriangles(p gltfPrimitive, fail func(property string, err error) error) error {
+	mode := 4 // TRIANGLES
+	if p.Mode != nil {
+		mode = *p.Mode
+	}
+	if mode < 4 {
+		// Points and lines have no surface to shade.
+		return nil
+	}
+
+	pi, ok := p.Attributes["POSITION"]
+	if !ok {
+		return fail("", fmt.Errorf("primitive has no POSITION attribute"))
+	}
+	positions, n, err := d.accessor(pi, 3)
+	if err == nil {
+		err = finiteAll(positions)
+	}
+	if err != nil {
+		return fail("POSITION", err)
+	}
+	var normals, texCoords, tangents []float32
+	for _, a := range []struct {
+		name   string
+		size   int
+		values *[]float32
+	}{
+		{"NORMAL", 3, &normals},
+		{"TEXCOORD_0", 2, &texCoords},
+		{"TANGENT", 4, &tangents},
+	} {
+		i, ok := p.Attributes[a.name]
+		if !ok {
+			continue
+		}
+		if *a.values, _, err = d.accessor(i, a.size); err == nil {
+			err = finiteAll(*a.values)
+		}
+		if err != nil {
+			return fail(a.name, err)
+		}
+	}
+	if len(normals) < 3*n {
+		normals = nil
+		d.m.HasNormals = false
+	}
+	if len(texCoords) < 2*n {
+		texCoords = nil
+		d.m.HasTexCoords = false
+	}
+	if len(tangents) < 4*n {
+		tangents = nil
+		d.m.HasTangents = false
+	}
+
+	// Colors, a second set of texture coordinates and custom attributes,
+	// whose names start with an underscore, are added to the model.
+	type extra struct {
+		attribute Attribute
+		size      int // Components of each value.
+		values    []float32
+	}
+	var extras []extra
+	var names []string
+	for name := range p.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := p.Attributes[name]
+		attr := name
+		switch {
+		case name == "COLOR_0":
+			attr = ColorAttribute
+		case name == "TEXCOORD_1":
+			attr = TexCoord1Attribute
+		case !strings.HasPrefix(name, "_"):
+			continue
+		}
+		if i < 0 || i >= len(d.doc.Accessors) {
+			return fail(name, fmt.Errorf("accessor %d out of range", i))
+		}
+		size := typeComponents[d.doc.Accessors[i].Type]
+		if size < 1 || size > 4 {
+			return fail(name, fmt.Errorf("unsupported accessor type: %s", d.doc.Accessors[i].Type))
+		}
+		values, count, err := d.accessor(i, size)
+		if err == nil {
+			err = finiteAll(values)
+		}
+		if err == nil && count < n {
+			err = fmt.Errorf("accessor %d has %d elements, expected %d", i, count, n)
+		}
+		if err != nil {
+			return fail(name, err)
+		}
+		attrSize := size
+		if attr == ColorAttribute {
+			// Colors without alpha are opaque.
+			attrSize = 4
+		}
+		extras = append(extras, extra{d.m.AddAttribute(attr, attrSize), size, values})
+	}
+
+	// The deltas of each morph target are added as attributes of their own.
+	for k, target := range p.Targets {
+		for _, a := range []struct{ name, prefix string }{
+			{"POSITION", MorphPositionPrefix},
+			{"NORMAL", MorphNormalPrefix},
+			{"TANGENT", MorphTangentPrefix},
+		} {
+			i, ok := target[a.name]
+			if !ok {
+				continue
+			}
+			values, count, err := d.accessor(i, 3)
+			if err == nil {
+				err = finiteAll(values)
+			}
+			if err == nil && count < n {
+				err = fmt.Errorf("accessor %d has %d elements, expected %d", i, count, n)
+			}
+			if err != nil {
+				return fail(fmt.Sprintf("targets[%d].%s", k, a.name), err)
+			}
+			extras = append(extras, extra{d.m.AddAttribute(MorphAttribute(a.prefix, k), 3), 3, values})
+		}
+	}
+
+	// Each set of joints and weights gives up to four more influences on
+	// each vertex, of which the strongest are kept.
+	var joints, weights [][]float32
+	for set := 0; ; set++ {
+		ji, hasJoints := p.Attributes[fmt.Sprintf("JOINTS_%d", set)]
+		wi, hasWeights := p.Attributes[fmt.Sprintf("WEIGHTS_%d", set)]
+		if !hasJoints || !hasWeights {
+			break
+		}
+		for _, a := range []struct {
+			name   string
+			i      int
+			values *[][]float32
+		}{
+			{fmt.Sprintf("JOINTS_%d", set), ji, &joints},
+			{fmt.Sprintf("WEIGHTS_%d", set), wi, &weights},
+		} {
+			values, count, err := d.accessor(a.i, 4)
+			if err == nil {
+				err = finiteAll(values)
+			}
+			if err == nil && count < n {
+				err = fmt.Errorf("accessor %d has %d elements, expected %d", a.i, count, n)
+			}
+			if err != nil {
+				return fail(a.name, err)
+			}
+			*a.values = append(*a.values, values)
+		}
+	}
+	var jointsOffset, weightsOffset int
+	if len(joints) > 0 {
+		jointsOffset = d.m.AddAttribute(JointsAttribute, MaxInfluences).Offset
+		weightsOffset = d.m.AddAttribute(WeightsAttribute, MaxInfluences).Offset
+	}
+	var influences []influence
+
+	var indices []uint32
+	if p.Indices != nil {
+		if indices, err = d.indices(*p.Indices); err != nil {
+			return fail("indices", err)
+		}
+		for _, v := range indices {
+			if int(v) >= n {
+				return fail("indices", fmt.Errorf("vertex index %d out of range", v))
+			}
+		}
+	} else {
+		indices = make([]uint32, n)
+		for i := range indices {
+			indices[i] = uint32(i)
+		}
+	}
+
+	base := uint32(len(d.m.VertexData) / d.m.Stride)
+	for i := 0; i < n; i++ {
+		v := d.m.defaultVertex()
+		copy(v[PositionOffset:], positions[3*i:3*i+3])
+		if normals != nil {
+			n := normalize3([3]float32{normals[3*i], normals[3*i+1], normals[3*i+2]})
+			copy(v[NormalOffset:], n[:])
+		}
+		if texCoords != nil {
+			copy(v[TexCoordOffset:], texCoords[2*i:2*i+2])
+		}
+		if tangents != nil {
+			t := normalize3([3]float32{tangents[4*i], tangents[4*i+1], tangents[4*i+2]})
+			copy(v[TangentOffset:], t[:])
+			v[TangentOffset+3] = tangents[4*i+3]
+		}
+		for _, e := range extras {
+			a, c := e.attribute, e.size
+			if c > a.Size {
+				c = a.Size
+			}
+			copy(v[a.Offset:a.Offset+c], e.values[e.size*i:])
+		}
+		if len(joints) > 0 {
+			influences = influences[:0]
+			for set := range joints {
+				for k := 0; k < 4; k++ {
+					if w := weights[set][4*i+k]; w > 0 {
+						influences = append(influences, influence{joints[set][4*i+k], w})
+					}
+				}
+			}
+			setInfluences(v, jointsOffset, weightsOffset, influences)
+		}
+		d.m.VertexData = append(d.m.VertexData, v...)
+	}
+
+	for _, t := range triangles(indices, mode) {
+		d.m.FaceData = append(d.m.FaceData, base+t[0], base+t[1], base+t[2])
+	}
+	return nil
+}
+
+// readMorphs adds the morph targets of the mesh of node i, named by the
+// mesh and weighted by the node, and returns the first of them and their
+// number.  Each node using a mesh has targets of its own.
+func (d *gltfDecoder) readMorphs(i int) (int, int) {
+	n := d.doc.Nodes[i]
+	mesh := d.doc.Meshes[*n.Mesh]
+	weights := mesh.Weights
+	if len(n.Weights) > 0 {
+		weights = n.Weights
+	}
+	first := len(d.m.Morphs)
+	for k := 0; k < d.targets(i); k++ {
+		var t Morph
+		if k < len(mesh.Extras.TargetNames) {
+			t.Name = mesh.Extras.TargetNames[k]
+		}
+		if k < len(weights) && !math.IsNaN(float64(weights[k])) && !math.IsInf(float64(weights[k]), 0) {
+			t.Weight = weights[k]
+		}
+		d.m.Morphs = append(d.m.Morphs, t)
+	}
+	return first, len(d.m.Morphs) - first
+}
+
+// readSkins adds the skins of the document, after the nodes they use, and
+// checks the joints of the vertices they deform.
+func (d *gltfDecoder) readSkins() error {
+	for i, gs := range d.doc.Skins {
+		skin := Skin{Name: gs.Name, Transform: ident4()}
+		for _, j := range gs.Joints {
+			n, ok := d.nodes[j]
+			if !ok {
+				return d.fail("skin", i, "joints", fmt.Errorf("joint node %d is not in the scene", j))
+			}
+			skin.Joints = append(skin.Joints, n)
+		}
+		skin.InverseBind = make([][16]float32, len(skin.Joints))
+		for j := range skin.InverseBind {
+			skin.InverseBind[j] = ident4()
+		}
+		if gs.InverseBindMatrices != nil {
+			values, count, err := d.accessor(*gs.InverseBindMatrices, 16)
+			if err == nil {
+				err = finiteAll(values)
+			}
+			if err == nil && count < len(skin.Joints) {
+				err = fmt.Errorf("accessor %d has %d elements, expected %d", *gs.InverseBindMatrices, count, len(skin.Joints))
+			}
+			if err != nil {
+				return d.fail("skin", i, "inverseBindMatrices", err)
+			}
+			for j := range skin.InverseBind {
+				copy(skin.InverseBind[j][:], values[16*j:])
+			}
+		}
+		d.m.Skins = append(d.m.Skins, skin)
+	}
+
+	joints, ok := d.m.Attribute(JointsAttribute)
+	if !ok {
+		return nil
+	}
+	for _, g := range d.m.Groups {
+		if g.Skin < 0 {
+			continue
+		}
+		for _, v := range d.m.FaceData[3*g.First : 3*(g.First+g.Count)] {
+			for k := 0; k < joints.Size; k++ {
+				if j := d.m.VertexData[int(v)*d.m.Stride+joints.Offset+k]; int(j) >= len(d.m.Skins[g.Skin].Joints) {
+					return d.fail("skin", g.Skin, "joints", fmt.Errorf("vertex joint %d out of range", int(j)))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readAnimations adds the animations of the document moving the nodes read.
+// Channels of other nodes, or of the weights of nodes without morph
+// targets, are skipped.
+func (d *gltfDecoder) readAnimations() error {
+	paths := map[string]ChannelPath{"translation": TranslationPath, "rotation": RotationPath, "scale": ScalePath, "weights": WeightsPath}
+	interpolations := map[string]Interpolation{"": LinearInterpolation, "LINEAR": LinearInterpolation, "STEP": StepInterpolation, "CUBICSPLINE": CubicSplineInterpolation}
+	for i, ga := range d.doc.Animations {
+		fail := func(property string, err error) error {
+			return d.fail("animation", i, property, err)
+		}
+		a := Animation{Name: ga.Name}
+		for j, gc := range ga.Channels {
+			path, ok := paths[gc.Target.Path]
+			if !ok || gc.Target.Node == nil {
+				continue
+			}
+			node, ok := d.nodes[*gc.Target.Node]
+			if !ok {
+				continue
+			}
+			// Weights channels hold a weight for each morph target.
+			size := 1
+			if path == WeightsPath {
+				if size = d.targets(*gc.Target.Node); size == 0 {
+					continue
+				}
+			}
+			if gc.Sampler < 0 || gc.Sampler >= len(ga.Samplers) {
+				return fail(fmt.Sprintf("channels[%d].sampler", j), fmt.Errorf("sampler %d out of range", gc.Sampler))
+			}
+			gs := ga.Samplers[gc.Sampler]
+			c := Channel{Node: node, Path: path}
+			if c.Interpolation, ok = interpolations[gs.Interpolation]; !ok {
+				return fail(fmt.Sprintf("samplers[%d].interpolation", gc.Sampler), fmt.Errorf("unsupported interpolation: %s", gs.Interpolation))
+			}
+			times, count, err := d.accessor(gs.Input, 1)
+			if err == nil {
+				err = finiteAll(times)
+			}
+			for k := 1; err == nil && k < count; k++ {
+				if times[k] < times[k-1] {
+					err = fmt.Errorf("key times are not in order")
+				}
+			}
+			if err != nil {
+				return fail(fmt.Sprintf("samplers[%d].input", gc.Sampler), err)
+			}
+			values, n, err := d.accessor(gs.Output, path.size())
+			if err == nil {
+				err = finiteAll(values)
+			}
+			want := count
+			if path == WeightsPath {
+				want *= size
+			}
+			if c.Interpolation == CubicSplineInterpolation {
+				want *= 3
+			}
+			if err == nil && n != want {
+				err = fmt.Errorf("accessor %d has %d elements, expected %d", gs.Output, n, want)
+			}
+			if err != nil {
+				return fail(fmt.Sprintf("samplers[%d].output", gc.Sampler), err)
+			}
+			c.Times, c.Values = times, values
+			if count > 0 && times[count-1] > a.Duration {
+				a.Duration = times[count-1]
+			}
+			a.Channels = append(a.Channels, c)
+		}
+		d.m.Animations = append(d.m.Animations, a)
+	}
+	return nil
+}
+
+// targets returns the number of morph targets of the mesh of node i.
+func (d *gltfDecoder) targets(i int) int {
+	n := d.doc.Nodes[i]
+	if n.Mesh == nil || *n.Mesh < 0 || *n.Mesh >= len(d.doc.Meshes) {
+		return 0
+	}
+	targets := 0
+	for _, p := range d.doc.Meshes[*n.Mesh].Primitives {
+		if len(p.Targets) > targets {
+			targets = len(p.Targets)
+		}
+	}
+	return targets
+}
+
+// triangles converts indices drawn with the given glTF primitive mode into
+// a list of triangles.
+func triangles(indices []uint32, mode int) [][3]uint32 {
+	var tris [][3]uint32
+	switch mode {
+	case 5: // TRIANGLE_STRIP
+		for i := 2; i < len(indices); i++ {
+			if i%2 == 0 {
+				tris = append(tris, [3]uint32{indices[i-2], indices[i-1], indices[i]})
+			} else {
+				tris = append(tris, [3]uint32{indices[i-1], indices[i-2], indices[i]})
+			}
+		}
+	case 6: // TRIANGLE_FAN
+		for i := 2; i < len(indices); i++ {
+			tris = append(tris, [3]uint32{indices[0], indices[i-1], indices[i]})
+		}
+	default:
+		for i := 2; i < len(indices); i += 3 {
+			tris = append(tris, [3]uint32{indices[i-2], indices[i-1], indices[i]})
+		}
+	}
+	return tris
+}
+
+// bufferView returns the bytes of buffer view i and its stride.
+func (d *gltfDecoder) bufferView(i int) ([]byte, int, error) {
+	if i < 0 || i >= len(d.doc.BufferViews) {
+		return nil, 0, fmt.Errorf("buffer view %d out of range", i)
+	}
+	bv := d.doc.BufferViews[i]
+	if bv.Buffer < 0 || bv.Buffer >= len(d.buffers) {
+		return nil, 0, fmt.Errorf("buffer %d out of range", bv.Buffer)
+	}
+	b := d.buffers[bv.Buffer]
+	if bv.ByteOffset < 0 || bv.ByteLength < 0 || bv.ByteOffset > len(b) || bv.ByteLength > len(b)-bv.ByteOffset {
+		return nil, 0, fmt.Errorf("buffer view %d exceeds its buffer", i)
+	}
+	if bv.ByteStride < 0 {
+		return nil, 0, fmt.Errorf("buffer view %d has a negative stride", i)
+	}
+	return b[bv.ByteOffset : bv.ByteOffset+bv.ByteLength], bv.ByteStride, nil
+}
+
+// accessor returns the values of accessor i as floats, along with the
+// number of elements.  Normalized integers are mapped to [0, 1] or [-1, 1].
+// Elements with fewer than size components are rejected.
+func (d *gltfDecoder) accessor(i, size int) ([]float32, int, error) {
+	if i < 0 || i >= len(d.doc.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %d out of range", i)
+	}
+	a := d.doc.Accessors[i]
+	comps, ok := typeComponents[a.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported accessor type: %s", a.Type)
+	}
+	if comps < size {
+		return nil, 0, fmt.Errorf("accessor %d has %d components, expected %d", i, comps, size)
+	}
+	csize, ok := componentSizes[a.ComponentType]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported component type: %d", a.ComponentType)
+	}
+	if a.Count < 0 || a.ByteOffset < 0 {
+		return nil, 0, fmt.Errorf("accessor %d has a negative count or offset", i)
+	}
+
+	// Elements are checked against the buffer view before any are
+	// allocated, so a corrupt count cannot exhaust memory.
+	var data []byte
+	stride := comps * csize
+	if a.BufferView != nil {
+		var err error
+		var viewStride int
+		if data, viewStride, err = d.bufferView(*a.BufferView); err != nil {
+			return nil, 0, err
+		}
+		if viewStride != 0 {
+			stride = viewStride
+		}
+		if !fits(a.ByteOffset, a.Count, stride, comps*csize, len(data)) {
+			return nil, 0, fmt.Errorf("accessor %d exceeds its buffer view", i)
+		}
+	} else if a.Count > maxZeroCount {
+		return nil, 0, fmt.Errorf("accessor %d has %d elements and no buffer view", i, a.Count)
+	}
+
+	values := make([]float32, a.Count*size)
+	if data != nil {
+		for e := 0; e < a.Count; e++ {
+			off := a.ByteOffset + e*stride
+			for c := 0; c < size; c++ {
+				values[e*size+c] = component(data[off+c*csize:], a.ComponentType, a.Normalized)
+			}
+		}
+	}
+
+	if s := a.Sparse; s != nil {
+		if !indexTypes[s.Indices.ComponentType] {
+			return nil, 0, fmt.Errorf("unsupported sparse index component type: %d", s.Indices.ComponentType)
+		}
+		isize := componentSizes[s.Indices.ComponentType]
+		idx, _, err := d.bufferView(s.Indices.BufferView)
+		if err != nil {
+			return nil, 0, err
+		}
+		vals, _, err := d.bufferView(s.Values.BufferView)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !fits(s.Indices.ByteOffset, s.Count, isize, isize, len(idx)) || !fits(s.Values.ByteOffset, s.Count, comps*csize, comps*csize, len(vals)) {
+			return nil, 0, fmt.Errorf("accessor %d sparse data exceeds its buffer view", i)
+		}
+		for j := 0; j < s.Count; j++ {
+			e := int(index(idx[s.Indices.ByteOffset+j*isize:], s.Indices.ComponentType))
+			if e < 0 || e >= a.Count {
+				return nil, 0, fmt.Errorf("accessor %d sparse index %d out of range", i, e)
+			}
+			off := s.Values.ByteOffset + j*comps*csize
+			for c := 0; c < size; c++ {
+				values[e*size+c] = component(vals[off+c*csize:], a.ComponentType, a.Normalized)
+			}
+		}
+	}
+	return values, a.Count, nil
+}
+
+// indices returns the values of the scalar accessor i as vertex indices.
+func (d *gltfDecoder) indices(i int) ([]uint32, error) {
+	if i < 0 || i >= len(d.doc.Accessors) {
+		return nil, fmt.Errorf("accessor %d out of range", i)
+	}
+	a := d.doc.Accessors[i]
+	if a.Type != "SCALAR" || a.BufferView == nil {
+		return nil, fmt.Errorf("accessor %d is not a scalar in a buffer view", i)
+	}
+	size := componentSizes[a.ComponentType]
+	if !indexTypes[a.ComponentType] {
+		return nil, fmt.Errorf("unsupported index component type: %d", a.ComponentType)
+	}
+	data, stride, err := d.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, err
+	}
+	if stride == 0 {
+		stride = size
+	}
+	if !fits(a.ByteOffset, a.Count, stride, size, len(data)) {
+		return nil, fmt.Errorf("accessor %d exceeds its buffer view", i)
+	}
+	values := make([]uint32, a.Count)
+	for e := range values {
+		values[e] = index(data[a.ByteOffset+e*stride:], a.ComponentType)
+	}
+	return values, nil
+}
+
+// fits reports whether count elements of size bytes, stride bytes apart
+// from offset, lie within n bytes.  Negative counts and offsets never fit.
+func fits(offset, count, stride, size, n int) bool {
+	if offset < 0 || count < 0 || stride < 0 || offset > n {
+		return false
+	}
+	if count == 0 {
+		return true
+	}
+	if size > n-offset {
+		return false
+	}
+	return stride == 0 || count-1 <= (n-offset-size)/stride
+}
+
+// index decodes a single little endian unsigned integer component from b.
+func index(b []byte, t int) uint32 {
+	switch t {
+	case 5121:
+		return uint32(b[0])
+	case 5123:
+		return uint32(binary.LittleEndian.Uint16(b))
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// component decodes a single little endian accessor component from b.
+func component(b []byte, t int, normalized bool) float32 {
+	switch t {
+	case 5120:
+		v := float32(int8(b[0]))
+		if normalized {
+			return float32(math.Max(float64(v)/127, -1))
+		}
+		return v
+	case 5121:
+		if normalized {
+			return float32(b[0]) / 255
+		}
+		return float32(b[0])
+	case 5122:
+		v := float32(int16(binary.LittleEndian.Uint16(b)))
+		if normalized {
+			return float32(math.Max(float64(v)/32767, -1))
+		}
+		return v
+	case 5123:
+		if normalized {
+			return float32(binary.LittleEndian.Uint16(b)) / 65535
+		}
+		return float32(binary.LittleEndian.Uint16(b))
+	case 5125:
+		return float32(binary.LittleEndian.Uint32(b))
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
+
+// finiteAll returns an error if any of v is NaN or infinite.
+func finiteAll(v []float32) error {
+	for _, f := range v {
+		if err := finite(float64(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
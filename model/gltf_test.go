@@ -0,0 +1,114 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadGLTF(t *testing.T) {
+	dir := t.TempDir()
+	js, bin := gltfTriangle([]uint16{0, 1, 2}, false)
+	external := strings.Replace(js, `"buffers": [{`, `"buffers": [{"uri": "triangle bin.bin", `, 1)
+	embedded, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	files := map[string][]byte{
+		"external.gltf":    []byte(external),
+		"triangle bin.bin": bin,
+		"embedded.gltf":    []byte(embedded),
+		"binary.glb":       glbTriangle([]uint16{0, 1, 2}),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}
+	for name, format := range map[string]string{"external.gltf": "gltf", "embedded.gltf": "gltf", "binary.glb": "glb"} {
+		m := New()
+		if err := m.LoadFile(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if m.Format != format || m.VertexCount != 3 || m.FaceCount != 1 {
+			t.Errorf("%s: got %s with %d vertices and %d faces, want %s with 3 and 1", name, m.Format, m.VertexCount, m.FaceCount, format)
+			continue
+		}
+		var got []float32
+		for i := uint32(0); i < 3; i++ {
+			p := m.vec3(i, PositionOffset)
+			got = append(got, p[:]...)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got positions %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestGLTFNodeTransforms(t *testing.T) {
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	nodes := `"nodes": [
+    {"children": [1], "translation": [1, 2, 3]},
+    {"mesh": 0, "scale": [2, 2, 2], "rotation": [0, 0, 0.70710678, 0.70710678]}
+  ]`
+	js = strings.Replace(js, `"nodes": [{"mesh": 0}]`, nodes, 1)
+	m := New()
+	if err := m.Load(strings.NewReader(js)); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(m.Groups))
+	}
+
+	// The triangle's vertex at x 1 is scaled, turned to y and translated.
+	p := transformPoint(m.Groups[0].Transform, m.vec3(1, PositionOffset))
+	for k, want := range [3]float32{1, 4, 3} {
+		if d := p[k] - want; d > 1e-5 || d < -1e-5 {
+			t.Fatalf("vertex 1 is placed at %v, want [1 4 3]", p)
+		}
+	}
+}
+
+func TestGLTFPrimitiveModes(t *testing.T) {
+	indices := []uint32{0, 1, 2, 3, 4}
+	tests := []struct {
+		mode int
+		want [][3]uint32
+	}{
+		{4, [][3]uint32{{0, 1, 2}}},
+		{5, [][3]uint32{{0, 1, 2}, {2, 1, 3}, {2, 3, 4}}},
+		{6, [][3]uint32{{0, 1, 2}, {0, 2, 3}, {0, 3, 4}}},
+	}
+	for _, test := range tests {
+		if got := triangles(indices, test.mode); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("mode %d: got %v, want %v", test.mode, got, test.want)
+		}
+	}
+
+	// Points and lines are not drawn.
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	js = strings.Replace(js, `"indices": 1}`, `"indices": 1, "mode": 1}`, 1)
+	m := New()
+	if err := m.Load(strings.NewReader(js)); err != nil {
+		t.Fatal(err)
+	}
+	if m.FaceCount != 0 {
+		t.Errorf("got %d triangles from lines, want none", m.FaceCount)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "math"
+
+// Matrices are 4x4, stored column-major as in OpenGL and glTF.
+
+func ident4() [16]float32 {
+	return [16]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+// mul4 returns a * b.
+func mul4(a, b [16]float32) [16]float32 {
+	var r [16]float32
+	for c := 0; c < 4; c++ {
+		for row := 0; row < 4; row++ {
+			var sum float32
+			for k := 0; k < 4; k++ {
+				sum += a[k*4+row] * b[c*4+k]
+			}
+			r[c*4+row] = sum
+		}
+	}
+	return r
+}
+
+// trs returns the matrix applying scale s, then rotation quaternion q
+// (x, y, z, w), then translation t.
+func trs(t [3]float32, q [4]float32, s [3]float32) [16]float32 {
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return [16]float32{
+		(1 - 2*(y*y+z*z)) * s[0], (2 * (x*y + z*w)) * s[0], (2 * (x*z - y*w)) * s[0], 0,
+		(2 * (x*y - z*w)) * s[1], (1 - 2*(x*x+z*z)) * s[1], (2 * (y*z + x*w)) * s[1], 0,
+		(2 * (x*z + y*w)) * s[2], (2 * (y*z - x*w)) * s[2], (1 - 2*(x*x+y*y)) * s[2], 0,
+		t[0], t[1], t[2], 1,
+	}
+}
+
+// inverse4 returns the inverse of m, or the identity if m is singular.
+func inverse4(m [16]float32) [16]float32 {
+	var a, inv [16]float64
+	for i, v := range m {
+		a[i] = float64(v)
+	}
+	inv[0] = a[5]*a[10]*a[15] - a[5]*a[11]*a[14] - a[9]*a[6]*a[15] + a[9]*a[7]*a[14] + a[13]*a[6]*a[11] - a[13]*a[7]*a[10]
+	inv[4] = -a[4]*a[10]*a[15] + a[4]*a[11]*a[14] + a[8]*a[6]*a[15] - a[8]*a[7]*a[14] - a[12]*a[6]*a[11] + a[12]*a[7]*a[10]
+	inv[8] = a[4]*a[9]*a[15] - a[4]*a[11]*a[13] - a[8]*a[5]*a[15] + a[8]*a[7]*a[13] + a[12]*a[5]*a[11] - a[12]*a[7]*a[9]
+	inv[12] = -a[4]*a[9]*a[14] + a[4]*a[10]*a[13] + a[8]*a[5]*a[14] - a[8]*a[6]*a[13] - a[12]*a[5]*a[10] + a[12]*a[6]*a[9]
+	inv[1] = -a[1]*a[10]*a[15] + a[1]*a[11]*a[14] + a[9]*a[2]*a[15] - a[9]*a[3]*a[14] - a[13]*a[2]*a[11] + a[13]*a[3]*a[10]
+	inv[5] = a[0]*a[10]*a[15] - a[0]*a[11]*a[14] - a[8]*a[2]*a[15] + a[8]*a[3]*a[14] + a[12]*a[2]*a[11] - a[12]*a[3]*a[10]
+	inv[9] = -a[0]*a[9]*a[15] + a[0]*a[11]*a[13] + a[8]*a[1]*a[15] - a[8]*a[3]*a[13] - a[12]*a[1]*a[11] + a[12]*a[3]*a[9]
+	inv[13] = a[0]*a[9]*a[14] - a[0]*a[10]*a[13] - a[8]*a[1]*a[14] + a[8]*a[2]*a[13] + a[12]*a[1]*a[10] - a[12]*a[2]*a[9]
+	inv[2] = a[1]*a[6]*a[15] - a[1]*a[7]*a[14] - a[5]*a[2]*a[15] + a[5]*a[3]*a[14] + a[13]*a[2]*a[7] - a[13]*a[3]*a[6]
+	inv[6] = -a[0]*a[6]*a[15] + a[0]*a[7]*a[14] + a[4]*a[2]*a[15] - a[4]*a[3]*a[14] - a[12]*a[2]*a[7] + a[12]*a[3]*a[6]
+	inv[10] = a[0]*a[5]*a[15] - a[0]*a[7]*a[13] - a[4]*a[1]*a[15] + a[4]*a[3]*a[13] + a[12]*a[1]*a[7] - a[12]*a[3]*a[5]
+	inv[14] = -a[0]*a[5]*a[14] + a[0]*a[6]*a[13] + a[4]*a[1]*a[14] - a[4]*a[2]*a[13] - a[12]*a[1]*a[6] + a[12]*a[2]*a[5]
+	inv[3] = -a[1]*a[6]*a[11] + a[1]*a[7]*a[10] + a[5]*a[2]*a[11] - a[5]*a[3]*a[10] - a[9]*a[2]*a[7] + a[9]*a[3]*a[6]
+	inv[7] = a[0]*a[6]*a[11] - a[0]*a[7]*a[10] - a[4]*a[2]*a[11] + a[4]*a[3]*a[10] + a[8]*a[2]*a[7] - a[8]*a[3]*a[6]
+	inv[11] = -a[0]*a[5]*a[11] + a[0]*a[7]*a[9] + a[4]*a[1]*a[11] - a[4]*a[3]*a[9] - a[8]*a[1]*a[7] + a[8]*a[3]*a[5]
+	inv[15] = a[0]*a[5]*a[10] - a[0]*a[6]*a[9] - a[4]*a[1]*a[10] + a[4]*a[2]*a[9] + a[8]*a[1]*a[6] - a[8]*a[2]*a[5]
+
+	det := a[0]*inv[0] + a[1]*inv[4] + a[2]*inv[8] + a[3]*inv[12]
+	if det == 0 {
+		return ident4()
+	}
+	var r [16]float32
+	for i := range r {
+		r[i] = float32(inv[i] / det)
+	}
+	return r
+}
+
+// decompose splits m, which must not shear, into the translation, rotation
+// quaternion and scale that trs combines.
+func decompose(m [16]float32) (t [3]float32, q [4]float32, s [3]float32) {
+	t = [3]float32{m[12], m[13], m[14]}
+	for c := 0; c < 3; c++ {
+		s[c] = length3([3]float32{m[4*c], m[4*c+1], m[4*c+2]})
+	}
+	if det3(m) < 0 {
+		s[0] = -s[0]
+	}
+	var r [9]float64
+	for c := 0; c < 3; c++ {
+		for row := 0; row < 3; row++ {
+			if s[c] != 0 {
+				r[3*c+row] = float64(m[4*c+row] / s[c])
+			}
+		}
+	}
+
+	// From the rotation matrix, choosing the largest component to divide
+	// by for accuracy.
+	switch trace := r[0] + r[4] + r[8]; {
+	case trace > 0:
+		k := 0.5 / math.Sqrt(trace+1)
+		q = [4]float32{float32((r[5] - r[7]) * k), float32((r[6] - r[2]) * k), float32((r[1] - r[3]) * k), float32(0.25 / k)}
+	case r[0] > r[4] && r[0] > r[8]:
+		k := 2 * math.Sqrt(1+r[0]-r[4]-r[8])
+		q = [4]float32{float32(0.25 * k), float32((r[3] + r[1]) / k), float32((r[6] + r[2]) / k), float32((r[5] - r[7]) / k)}
+	case r[4] > r[8]:
+		k := 2 * math.Sqrt(1+r[4]-r[0]-r[8])
+		q = [4]float32{float32((r[3] + r[1]) / k), float32(0.25 * k), float32((r[7] + r[5]) / k), float32((r[6] - r[2]) / k)}
+	default:
+		k := 2 * math.Sqrt(1+r[8]-r[0]-r[4])
+		q = [4]float32{float32((r[6] + r[2]) / k), float32((r[7] + r[5]) / k), float32(0.25 * k), float32((r[1] - r[3]) / k)}
+	}
+	return t, normalizeQuat(q), s
+}
+
+// normalizeQuat returns q scaled to unit length, or the identity rotation
+// if it has no length.
+func normalizeQuat(q [4]float32) [4]float32 {
+	l := math.Sqrt(float64(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3]))
+	if l == 0 {
+		return [4]float32{0, 0, 0, 1}
+	}
+	return [4]float32{q[0] / float32(l), q[1] / float32(l), q[2] / float32(l), q[3] / float32(l)}
+}
+
+// slerp returns the rotation a fraction t of the way from a to b, along the
+// shortest arc.
+func slerp(a, b [4]float32, t float32) [4]float32 {
+	d := float64(a[0]*b[0] + a[1]*b[1] + a[2]*b[2] + a[3]*b[3])
+	if d < 0 {
+		d = -d
+		b = [4]float32{-b[0], -b[1], -b[2], -b[3]}
+	}
+	wa, wb := 1-float64(t), float64(t)
+	if d < 0.9995 {
+		theta := math.Acos(d)
+		sin := math.Sin(theta)
+		wa, wb = math.Sin((1-float64(t))*theta)/sin, math.Sin(float64(t)*theta)/sin
+	}
+	var q [4]float32
+	for k := range q {
+		q[k] = float32(wa)*a[k] + float32(wb)*b[k]
+	}
+	return normalizeQuat(q)
+}
+
+// transformPoint returns m applied to point p.
+func transformPoint(m [16]float32, p [3]float32) [3]float32 {
+	return [3]float32{
+		m[0]*p[0] + m[4]*p[1] + m[8]*p[2] + m[12],
+		m[1]*p[0] + m[5]*p[1] + m[9]*p[2] + m[13],
+		m[2]*p[0] + m[6]*p[1] + m[10]*p[2] + m[14],
+	}
+}
+
+// transformVector returns the upper 3x3 of m applied to v.
+func transformVector(m [16]float32, v [3]float32) [3]float32 {
+	return [3]float32{
+		m[0]*v[0] + m[4]*v[1] + m[8]*v[2],
+		m[1]*v[0] + m[5]*v[1] + m[9]*v[2],
+		m[2]*v[0] + m[6]*v[1] + m[10]*v[2],
+	}
+}
+
+// normalMatrix returns the inverse transpose of the upper 3x3 of m, as a 4x4
+// matrix for use with transformVector.  Results are scaled by the absolute
+// determinant of m, so transformed normals must be renormalized.
+func normalMatrix(m [16]float32) [16]float32 {
+	// The cofactor matrix equals the inverse transpose times the
+	// determinant.
+	n := [16]float32{
+		m[5]*m[10] - m[6]*m[9], m[6]*m[8] - m[4]*m[10], m[4]*m[9] - m[5]*m[8], 0,
+		m[2]*m[9] - m[1]*m[10], m[0]*m[10] - m[2]*m[8], m[1]*m[8] - m[0]*m[9], 0,
+		m[1]*m[6] - m[2]*m[5], m[2]*m[4] - m[0]*m[6], m[0]*m[5] - m[1]*m[4], 0,
+		0, 0, 0, 1,
+	}
+	if det3(m) < 0 {
+		for i := 0; i < 11; i++ {
+			n[i] = -n[i]
+		}
+	}
+	return n
+}
+
+// det3 returns the determinant of the upper 3x3 of m.
+func det3(m [16]float32) float32 {
+	return m[0]*(m[5]*m[10]-m[6]*m[9]) -
+		m[4]*(m[1]*m[10]-m[2]*m[9]) +
+		m[8]*(m[1]*m[6]-m[2]*m[5])
+}
+
+func sub3(a, b [3]float32) [3]float32 {
+	return [3]float32{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func cross3(a, b [3]float32) [3]float32 {
+	return [3]float32{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func dot3(a, b [3]float32) float32 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func length3(v [3]float32) float32 {
+	return float32(math.Sqrt(float64(dot3(v, v))))
+}
+
+// normalize3 returns v scaled to unit length, or v if it has no length.
+func normalize3(v [3]float32) [3]float32 {
+	l := length3(v)
+	if l == 0 {
+		return v
+	}
+	return [3]float32{v[0] / l, v[1] / l, v[2] / l}
+}
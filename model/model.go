@@ -19,144 +19,206 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"log"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
-var Formats = [...]string{
-	"format ascii 1.0",
-}
+// Offsets of the standard attributes within a vertex of VertexData, which
+// take the first VertexSize floats of each vertex.  Tangents have four
+// components, the fourth being the handedness of the bitangent.
+const (
+	PositionOffset = 0
+	NormalOffset   = 3
+	TexCoordOffset = 6
+	TangentOffset  = 8
+	VertexSize     = 12
+)
 
 type Model struct {
-	Format      string
-	VertexCount int
-	FaceCount   int
-	VertexData  []float32
-	FaceData    []uint32
+	Format       string
+	VertexCount  int
+	FaceCount    int
+	VertexData   []float32
+	Stride       int // Floats per vertex, VertexSize plus those of Attributes.
+	Attributes   []Attribute
+	FaceData     []uint32
+	Polygons     []int // Vertices of each polygon FaceData was split from, in order, nil if only triangles.
+	HasNormals   bool
+	HasTexCoords bool
+	HasTangents  bool
+	Materials    []Material
+	Groups       []Group
+	Nodes        []Node // Transforms the joints of Skins are placed by.
+	Skins        []Skin
+	Animations   []Animation
+	Morphs       []Morph
+}
+
+// Material describes the textures used to render part of a model.  Texture
+// filenames are joined to the directory of the model when it is loaded.
+// Images embedded in the model are held in the matching Data field instead.
+type Material struct {
+	Name          string
+	ColorMap      string
+	ColorMapData  []byte
+	NormalMap     string
+	NormalMapData []byte
+}
+
+// Group is a named range of triangles in FaceData sharing a material and a
+// transform, drawn as one part of the model.
+type Group struct {
+	Name      string
+	Material  int         // Index into Materials, -1 if none.
+	First     int         // First triangle.
+	Count     int         // Number of triangles.
+	Transform [16]float32 // Column-major transform from the group's vertices to model space.
+	Skin      int         // Index into Skins deforming the group, -1 if none.
+
+	// The morph targets deforming the group are MorphCount of Morphs from
+	// FirstMorph, the kth of them held in the kth morph attributes.  Their
+	// weights are posed by those of Node.
+	FirstMorph int
+	MorphCount int
+	Node       int // Index into Nodes of the node placing the group, -1 if none.
 }
 
 func New() Model {
-	m := Model{}
+	m := Model{Stride: VertexSize}
 	return m
 
 }
 
+// Clone returns a copy of m that shares no data with it.
+func (m Model) Clone() Model {
+	c := m
+	c.VertexData = append([]float32(nil), m.VertexData...)
+	c.Attributes = append([]Attribute(nil), m.Attributes...)
+	c.FaceData = append([]uint32(nil), m.FaceData...)
+	c.Polygons = append([]int(nil), m.Polygons...)
+	c.Materials = append([]Material(nil), m.Materials...)
+	c.Groups = append([]Group(nil), m.Groups...)
+	c.Nodes = append([]Node(nil), m.Nodes...)
+	c.Morphs = append([]Morph(nil), m.Morphs...)
+	c.Skins = append([]Skin(nil), m.Skins...)
+	for i := range c.Skins {
+		c.Skins[i].InverseBind = append([][16]float32(nil), m.Skins[i].InverseBind...)
+	}
+	return c
+}
+
+// Load reads a model from r, detecting its format from the leading bytes.
 func (m *Model) Load(r io.Reader) error {
-	scanner := bufio.NewScanner(r)
+	return m.LoadWith(r, LoadOptions{})
+}
 
-	if err := m.readHeader(scanner); err != nil {
-		return fmt.Errorf("could not read header:", err)
+// LoadWith reads a model from r as Load does, following opts.
+func (m *Model) LoadWith(r io.Reader, opts LoadOptions) error {
+	if opts.Progress != nil {
+		r = &progressReader{r: r, size: -1, progress: opts.Progress}
 	}
-
-	if err := m.readVertices(scanner); err != nil {
-		return fmt.Errorf("could not read vertices:", err)
+	br := bufio.NewReaderSize(r, readBufferSize)
+	f, err := sniff(br)
+	if err != nil {
+		return err
 	}
-
-	if err := m.readFaces(scanner); err != nil {
-		return fmt.Errorf("could not read faces:", err)
+	*m = New()
+	if err := f.decode(m, br, ".", opts); err != nil {
+		return err
 	}
-
+	m.defaultTransforms()
+	m.convert(opts)
 	return nil
 }
 
-func (m Model) String() string {
-	msg := "PLY{\n"
-	msg += fmt.Sprintf("  Format: %s\n", m.Format)
-	msg += fmt.Sprintf("  VertexCount: %d\n", m.VertexCount)
-	msg += fmt.Sprintf("  FaceCount: %d\n", m.FaceCount)
-	msg += fmt.Sprintf("  VertexData: %v\n", m.VertexData)
-	msg += fmt.Sprintf("  FaceData: %v\n", m.FaceData)
-	msg += "}"
-	return msg
+// LoadFile reads the model stored in filename, choosing its format by the
+// file extension or, failing that, the leading bytes.  Errors found in the
+// file are returned as a *ParseError.  Names starting with BuiltinPrefix
+// are generated instead.
+func (m *Model) LoadFile(filename string) error {
+	return m.LoadFileWith(filename, LoadOptions{})
 }
 
-func (m *Model) readHeader(scanner *bufio.Scanner) error {
-	// Magic
-	scanner.Scan()
-	if magic := scanner.Text(); magic != "ply" {
-		return fmt.Errorf("invalid ply file, expected 'ply' got '%s'", magic)
-	}
-
-	// format/version
-	scanner.Scan()
-	m.Format = scanner.Text()
-	supported := false
-	for i := range Formats {
-		if m.Format == Formats[i] {
-			supported = true
+// LoadFileWith reads the model stored in filename as LoadFile does,
+// following opts.
+func (m *Model) LoadFileWith(filename string, opts LoadOptions) error {
+	if strings.HasPrefix(filename, BuiltinPrefix) {
+		if err := m.loadBuiltin(strings.TrimPrefix(filename, BuiltinPrefix)); err != nil {
+			return err
 		}
+		m.convert(opts)
+		return nil
 	}
-	if !supported {
-		return fmt.Errorf("unsupported format: %s", m.Format)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	var line string
-	var t string
-	var c int
-	for scanner.Scan() {
-		line = scanner.Text()
-		if strings.HasPrefix(line, "end_header") {
-			break
+	var r io.Reader = file
+	if opts.Progress != nil {
+		size := int64(-1)
+		if fi, err := file.Stat(); err == nil && fi.Mode().IsRegular() {
+			size = fi.Size()
 		}
-		if strings.HasPrefix(line, "element") {
-			if _, err := fmt.Sscan(line, &t, &t, &c); err != nil {
-				return fmt.Errorf("trouble scanning header: %s", err)
-			}
-			if t == "vertex" {
-				m.VertexCount = c
-			} else if t == "face" {
-				m.FaceCount = c
-			}
+		r = &progressReader{r: file, size: size, progress: opts.Progress}
+	}
+	br := bufio.NewReaderSize(r, readBufferSize)
+	f, ok := formatByExt(filepath.Ext(filename))
+	if !ok {
+		if f, err = sniff(br); err != nil {
+			return err
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+	*m = New()
+	err = f.decode(m, br, filepath.Dir(filename), opts)
+	if e, ok := err.(*ParseError); ok && e.File == "" {
+		e.File = filename
 	}
-
+	m.defaultTransforms()
+	if err != nil {
+		return err
+	}
+	m.convert(opts)
 	return nil
 }
 
-func (m *Model) readVertices(scanner *bufio.Scanner) error {
-	m.VertexData = make([]float32, 8*m.VertexCount)
-	var line string
-	var x, y, z, nx, ny, nz, s, t float32
-	for i := 0; i < m.VertexCount; i++ {
-		scanner.Scan()
-		line = scanner.Text()
-		if _, err := fmt.Sscan(line, &x, &y, &z, &nx, &ny, &nz, &s, &t); err != nil {
-			return fmt.Errorf("trouble scanning vertex: %s", err)
-		}
-		m.VertexData[(i*8)+0] = x
-		m.VertexData[(i*8)+1] = y
-		m.VertexData[(i*8)+2] = z
-		m.VertexData[(i*8)+3] = nx
-		m.VertexData[(i*8)+4] = ny
-		m.VertexData[(i*8)+5] = nz
-		m.VertexData[(i*8)+6] = s
-		m.VertexData[(i*8)+7] = t
-		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("trouble scanning vertices: %s", err)
-		}
+// SaveFile writes m to filename, choosing the format by the file extension.
+// Formats with both a text and a binary encoding use the text one when ascii
+// is set.  Group transforms are applied to the vertices written, as no
+// format written keeps them.
+func (m Model) SaveFile(filename string, ascii bool) error {
+	if m.HasTransforms() {
+		m = m.Clone()
+		m.Bake()
 	}
-	return nil
+	e, ok := encoderByExt(filepath.Ext(filename))
+	if !ok {
+		return fmt.Errorf("no encoder for %s files", filepath.Ext(filename))
+	}
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := e.encode(m, w, ascii); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
 }
 
-func (m *Model) readFaces(scanner *bufio.Scanner) error {
-	m.FaceData = make([]uint32, 3*m.FaceCount)
-	var line string
-	var c, v0, v1, v2 uint32
-	for i := 0; i < m.FaceCount; i++ {
-		scanner.Scan()
-		line = scanner.Text()
-		if _, err := fmt.Sscan(line, &c, &v0, &v1, &v2); err != nil {
-			return fmt.Errorf("trouble scanning faces: %s", err)
-		}
-		m.FaceData[(i*3)+0] = v0
-		m.FaceData[(i*3)+1] = v1
-		m.FaceData[(i*3)+2] = v2
-		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("trouble scanning vertices: %s", err)
-		}
-	}
-	return nil
+func (m Model) String() string {
+	msg := "Model{\n"
+	msg += fmt.Sprintf("  Format: %s\n", m.Format)
+	msg += fmt.Sprintf("  VertexCount: %d\n", m.VertexCount)
+	msg += fmt.Sprintf("  FaceCount: %d\n", m.FaceCount)
+	msg += fmt.Sprintf("  HasNormals: %t\n", m.HasNormals)
+	msg += fmt.Sprintf("  HasTexCoords: %t\n", m.HasTexCoords)
+	msg += fmt.Sprintf("  HasTangents: %t\n", m.HasTangents)
+	msg += fmt.Sprintf("  Materials: %d\n", len(m.Materials))
+	msg += fmt.Sprintf("  Groups: %d\n", len(m.Groups))
+	msg += "}"
+	return msg
 }
@@ -0,0 +1,92 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadProgress checks that loading a file of each format reports its
+// whole size read.
+func TestLoadProgress(t *testing.T) {
+	m := savedModel()
+	files := map[string][]byte{"model.glb": glbTriangle([]uint16{0, 1, 2})}
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	files["model.gltf"] = []byte(js)
+	for _, ext := range []string{".ply", ".obj", ".stl"} {
+		var buf bytes.Buffer
+		e, _ := encoderByExt(ext)
+		if err := e.encode(m, &buf, true); err != nil {
+			t.Fatal(err)
+		}
+		files["model"+ext] = buf.Bytes()
+	}
+
+	for name, data := range files {
+		filename := filepath.Join(t.TempDir(), name)
+		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var read, size int64
+		opts := LoadOptions{Progress: func(r, s int64) {
+			if r < read {
+				t.Errorf("%s: progress went from %d to %d", name, read, r)
+			}
+			read, size = r, s
+		}}
+		l := New()
+		if err := l.LoadFileWith(filename, opts); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if want := int64(len(data)); read != want || size != want {
+			t.Errorf("%s: got %d of %d bytes read, want %d", name, read, size, want)
+		}
+	}
+}
+
+// BenchmarkLoad loads each model in assets/models, and a large generated
+// one to measure parsing in chunks.
+func BenchmarkLoad(b *testing.B) {
+	filenames, err := filepath.Glob(filepath.Join("..", "assets", "models", "*"))
+	if err != nil || len(filenames) == 0 {
+		b.Fatalf("no models found: %v", err)
+	}
+	names := []string{"large.ply"}
+	files := map[string][]byte{"large.ply": largePLY(b)}
+	for _, filename := range filenames {
+		name := filepath.Base(filename)
+		if files[name], err = ioutil.ReadFile(filename); err != nil {
+			b.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		data := files[name]
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				m := New()
+				if err := m.Load(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
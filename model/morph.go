@@ -0,0 +1,164 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of the names of the attributes holding the deltas of each morph
+// target, followed by the index of the target.
+const (
+	MorphPositionPrefix = "MorphPosition"
+	MorphNormalPrefix   = "MorphNormal"
+	MorphTangentPrefix  = "MorphTangent"
+)
+
+// maxMorphs limits the morph targets found from the names of attributes.
+const maxMorphs = 256
+
+// Morph is a morph target, or blend shape.  Its deltas to the positions,
+// normals and tangents of the vertices of the groups it deforms are held in
+// attributes named by the morph prefixes and its index among the targets of
+// those groups, so they follow the vertices as the model is changed.  The
+// deltas are added to the vertices scaled by the weight of the target.
+type Morph struct {
+	Name   string
+	Weight float32 // Weight at rest.
+}
+
+// MorphAttribute returns the name of the attribute holding the deltas of
+// morph target i with the given prefix.
+func MorphAttribute(prefix string, i int) string {
+	return fmt.Sprintf("%s%d", prefix, i)
+}
+
+// morphDeltas returns the offsets of the position, normal and tangent
+// deltas of each morph target of m, -1 for those it has none of.
+func (m Model) morphDeltas() [][3]int {
+	deltas := make([][3]int, len(m.Morphs))
+	for i := range deltas {
+		for k, prefix := range []string{MorphPositionPrefix, MorphNormalPrefix, MorphTangentPrefix} {
+			deltas[i][k] = -1
+			if a, ok := m.Attribute(MorphAttribute(prefix, i)); ok && a.Size >= 3 {
+				deltas[i][k] = a.Offset
+			}
+		}
+	}
+	return deltas
+}
+
+// MorphWeights returns the weight of each morph target of m, posed as
+// given.  The weights of the nodes placing the groups, when set, such as by
+// an animation, override those at rest of the targets of each group.
+func (m Model) MorphWeights(pose []Node) []float32 {
+	weights := make([]float32, len(m.Morphs))
+	for i, t := range m.Morphs {
+		weights[i] = t.Weight
+	}
+	for _, g := range m.Groups {
+		if g.Node >= 0 && g.Node < len(pose) {
+			copy(g.Morphs(weights), pose[g.Node].Weights)
+		}
+	}
+	return weights
+}
+
+// Morphs returns the part of weights, one for each morph target of a model,
+// belonging to the targets deforming g.
+func (g Group) Morphs(weights []float32) []float32 {
+	first, last := g.FirstMorph, g.FirstMorph+g.MorphCount
+	if first < 0 || last > len(weights) || first > last {
+		return nil
+	}
+	return weights[first:last]
+}
+
+// MaxMorphs returns the largest number of morph targets deforming any part
+// of m.
+func (m Model) MaxMorphs() int {
+	max := 0
+	for _, g := range m.Parts() {
+		if g.MorphCount > max {
+			max = g.MorphCount
+		}
+	}
+	return max
+}
+
+// ApplyMorphs adds the deltas of the morph targets of m to its vertices,
+// scaled by the given weights, one for each target, blending them on the
+// CPU.  Vertices shared by groups are blended by the targets of the first.
+// Normals and tangents are normalized again.  The targets are kept, with
+// their deltas now relative to the blended vertices.
+func (m *Model) ApplyMorphs(weights []float32) {
+	deltas := m.morphDeltas()
+	if len(deltas) == 0 || len(weights) == 0 {
+		return
+	}
+	done := make([]bool, m.VertexCount)
+	for _, g := range m.Parts() {
+		weights := g.Morphs(weights)
+		for _, i := range m.FaceData[3*g.First : 3*(g.First+g.Count)] {
+			if int(i) >= m.VertexCount || done[i] {
+				continue
+			}
+			done[i] = true
+			v := m.VertexData[int(i)*m.Stride : int(i+1)*m.Stride]
+			for j, w := range weights {
+				if j >= len(deltas) || w == 0 {
+					continue
+				}
+				for k, o := range []int{PositionOffset, NormalOffset, TangentOffset} {
+					if d := deltas[j][k]; d >= 0 {
+						for c := 0; c < 3; c++ {
+							v[o+c] += w * v[d+c]
+						}
+					}
+				}
+			}
+			m.setVec3(i, NormalOffset, normalize3(m.vec3(i, NormalOffset)))
+			m.setVec3(i, TangentOffset, normalize3(m.vec3(i, TangentOffset)))
+		}
+	}
+}
+
+// findMorphs adds morph targets for the deltas m has attributes for beyond
+// its targets, such as those of a model read back from a PLY file.
+func (m *Model) findMorphs() {
+	for _, a := range m.Attributes {
+		for _, prefix := range []string{MorphPositionPrefix, MorphNormalPrefix, MorphTangentPrefix} {
+			i, err := strconv.Atoi(strings.TrimPrefix(a.Name, prefix))
+			if strings.HasPrefix(a.Name, prefix) && err == nil && i >= 0 && i < maxMorphs {
+				for len(m.Morphs) <= i {
+					m.Morphs = append(m.Morphs, Morph{})
+				}
+			}
+		}
+	}
+}
+
+// IsMorphAttribute reports whether the named attribute holds the deltas of
+// a morph target.
+func IsMorphAttribute(name string) bool {
+	for _, prefix := range []string{MorphPositionPrefix, MorphNormalPrefix, MorphTangentPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// morphedMeshes returns a glTF file with two meshes of morph targets, the
+// first moving a triangle up, the second right and forward.  The first mesh
+// is used by two nodes, and an animation sets the weights of the second.
+func morphedMeshes() string {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []float32{
+		0, 0, 0, 1, 0, 0, 0, 1, 0, // Positions
+		0, 1, 0, 0, 1, 0, 0, 1, 0, // Up
+		1, 0, 0, 1, 0, 0, 1, 0, 0, // Right
+		0, 0, 1, 0, 0, 1, 0, 0, 1, // Forward
+		0,        // Key time
+		0.3, 0.6, // Key weights
+	})
+	views := []string{
+		`{"buffer": 0, "byteOffset": 0, "byteLength": 36}`,
+		`{"buffer": 0, "byteOffset": 36, "byteLength": 36}`,
+		`{"buffer": 0, "byteOffset": 72, "byteLength": 36}`,
+		`{"buffer": 0, "byteOffset": 108, "byteLength": 36}`,
+		`{"buffer": 0, "byteOffset": 144, "byteLength": 4}`,
+		`{"buffer": 0, "byteOffset": 148, "byteLength": 8}`,
+	}
+	var accessors []string
+	for i, count := range []int{3, 3, 3, 3, 1, 2} {
+		typ := "VEC3"
+		if count < 3 {
+			typ = "SCALAR"
+		}
+		accessors = append(accessors, fmt.Sprintf(`{"bufferView": %d, "componentType": 5126, "count": %d, "type": "%s"}`, i, count, typ))
+	}
+	return fmt.Sprintf(`{
+  "asset": {"version": "2.0"},
+  "buffers": [{"uri": "data:application/octet-stream;base64,%s", "byteLength": %d}],
+  "bufferViews": [%s],
+  "accessors": [%s],
+  "meshes": [
+    {"primitives": [{"attributes": {"POSITION": 0}, "targets": [{"POSITION": 1}]}], "weights": [0.5]},
+    {"primitives": [{"attributes": {"POSITION": 0}, "targets": [{"POSITION": 2}, {"POSITION": 3}]}], "weights": [0.25, 0.75]}
+  ],
+  "nodes": [{"mesh": 0}, {"mesh": 1, "weights": [1, 0]}, {"mesh": 0, "weights": [0.1]}],
+  "scenes": [{"nodes": [0, 1, 2]}],
+  "animations": [{
+    "channels": [{"sampler": 0, "target": {"node": 1, "path": "weights"}}],
+    "samplers": [{"input": 4, "output": 5, "interpolation": "STEP"}]
+  }]
+}`, base64.StdEncoding.EncodeToString(buf.Bytes()), buf.Len(), strings.Join(views, ", "), strings.Join(accessors, ", "))
+}
+
+func TestMorphsPerNode(t *testing.T) {
+	m := New()
+	if err := m.Load(strings.NewReader(morphedMeshes())); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Morphs) != 4 || len(m.Groups) != 3 {
+		t.Fatalf("got %d morph targets and %d groups, want 4 and 3", len(m.Morphs), len(m.Groups))
+	}
+	for i, want := range [][3]int{{0, 1, 0}, {1, 2, 1}, {3, 1, 2}} {
+		g := m.Groups[i]
+		if got := [3]int{g.FirstMorph, g.MorphCount, g.Node}; got != want {
+			t.Errorf("group %d has first morph, morph count and node %v, want %v", i, got, want)
+		}
+	}
+	if n := m.MaxMorphs(); n != 2 {
+		t.Errorf("got %d morph targets at most in a part, want 2", n)
+	}
+
+	rest := m.MorphWeights(m.Pose(-1, 0))
+	if want := []float32{0.5, 1, 0, 0.1}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("got weights %v at rest, want %v", rest, want)
+	}
+	if got, want := m.MorphWeights(m.Pose(0, 0)), []float32{0.5, 0.3, 0.6, 0.1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got weights %v animated, want %v", got, want)
+	}
+	if got, want := m.Groups[1].Morphs(rest), []float32{1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got weights %v for group 1, want %v", got, want)
+	}
+
+	// The first node using the shared mesh blends its vertices.
+	m.ApplyMorphs(rest)
+	for i, want := range [][3]float32{{0, 0.5, 0}, {1, 0, 0}} {
+		if got := m.vec3(m.FaceData[3*m.Groups[i].First], PositionOffset); got != want {
+			t.Errorf("group %d vertex moved to %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestMorphNormalsAndTangents(t *testing.T) {
+	m := savedModel()
+	normals := m.AddAttribute(MorphAttribute(MorphNormalPrefix, 0), 3)
+	tangents := m.AddAttribute(MorphAttribute(MorphTangentPrefix, 0), 3)
+	for i := 0; i < m.VertexCount; i++ {
+		copy(m.VertexData[i*m.Stride+normals.Offset:], []float32{0, 1, -1})
+		copy(m.VertexData[i*m.Stride+tangents.Offset:], []float32{-1, 1, 0})
+	}
+	for _, name := range []string{normals.Name, tangents.Name, MorphAttribute(MorphPositionPrefix, 3)} {
+		if !IsMorphAttribute(name) {
+			t.Errorf("%s is not a morph attribute", name)
+		}
+	}
+	if IsMorphAttribute(ColorAttribute) {
+		t.Errorf("%s is a morph attribute", ColorAttribute)
+	}
+
+	// Scaling the model scales the position deltas, leaving the normal
+	// and tangent deltas, which are relative to unit vectors, as they are.
+	m.Transform(trs([3]float32{}, [4]float32{0, 0, 0, 1}, [3]float32{2, 2, 2}))
+	positions, _ := m.Attribute(MorphAttribute(MorphPositionPrefix, 0))
+	if d := m.vec3(1, positions.Offset); d != [3]float32{0, 0, 4} {
+		t.Errorf("position delta of vertex 1 scaled to %v, want [0 0 4]", d)
+	}
+	if d := m.vec3(1, normals.Offset); d != [3]float32{0, 1, -1} {
+		t.Errorf("normal delta of vertex 1 scaled to %v, want [0 1 -1]", d)
+	}
+
+	// Fully blended, the normals and tangents both turn to +Y.
+	m.ApplyMorphs([]float32{1})
+	for i := uint32(0); i < uint32(m.VertexCount); i++ {
+		if n := m.vec3(i, NormalOffset); n != [3]float32{0, 1, 0} {
+			t.Errorf("vertex %d has normal %v, want [0 1 0]", i, n)
+		}
+		if tangent := m.vec3(i, TangentOffset); tangent != [3]float32{0, 1, 0} {
+			t.Errorf("vertex %d has tangent %v, want [0 1 0]", i, tangent)
+		}
+	}
+}
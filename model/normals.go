@@ -0,0 +1,213 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// NormalMode selects how GenerateNormals computes vertex normals.
+type NormalMode int
+
+const (
+	// FlatNormals gives every triangle its own vertices, using the
+	// triangle's normal.
+	FlatNormals NormalMode = iota
+	// SmoothNormals averages the normals of the triangles around a
+	// vertex, weighted by their area.
+	SmoothNormals
+	// AngleNormals averages the normals of the triangles around a vertex,
+	// weighted by their angle at the vertex.
+	AngleNormals
+	// CreaseNormals is AngleNormals, except triangles meeting at more
+	// than the crease angle are not averaged, splitting their vertices.
+	CreaseNormals
+)
+
+var normalModeNames = [...]string{"flat", "smooth", "angle", "crease"}
+
+func (n NormalMode) String() string {
+	if n < 0 || int(n) >= len(normalModeNames) {
+		return fmt.Sprintf("NormalMode(%d)", int(n))
+	}
+	return normalModeNames[n]
+}
+
+// ParseNormalMode returns the NormalMode with the given name.
+func ParseNormalMode(s string) (NormalMode, error) {
+	for i, name := range normalModeNames {
+		if s == name {
+			return NormalMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown normal mode: %s", s)
+}
+
+// GenerateNormals replaces the normals of m with ones computed from its
+// triangles.  Vertices at the same position are smoothed together even if
+// other attributes, such as texture coordinates, differ.  The crease angle,
+// in degrees, is only used by CreaseNormals.
+func (m *Model) GenerateNormals(mode NormalMode, creaseAngle float64) {
+	faces := m.faceNormals()
+	switch mode {
+	case FlatNormals:
+		m.flatNormals(faces)
+	case SmoothNormals, AngleNormals:
+		m.smoothNormals(faces, mode == AngleNormals)
+	case CreaseNormals:
+		m.creaseNormals(faces, float32(math.Cos(creaseAngle*math.Pi/180)))
+	}
+	m.HasNormals = true
+}
+
+// faceNormals returns the unnormalized normal of each triangle, whose length
+// is twice the triangle's area.
+func (m *Model) faceNormals() [][3]float32 {
+	faces := make([][3]float32, m.FaceCount)
+	for t := range faces {
+		pa := m.vec3(m.FaceData[3*t], PositionOffset)
+		pb := m.vec3(m.FaceData[3*t+1], PositionOffset)
+		pc := m.vec3(m.FaceData[3*t+2], PositionOffset)
+		faces[t] = cross3(sub3(pb, pa), sub3(pc, pa))
+	}
+	return faces
+}
+
+// cornerAngle returns the angle of triangle t at its k'th corner.
+func (m *Model) cornerAngle(t, k int) float32 {
+	p := m.vec3(m.FaceData[3*t+k], PositionOffset)
+	a := normalize3(sub3(m.vec3(m.FaceData[3*t+(k+1)%3], PositionOffset), p))
+	b := normalize3(sub3(m.vec3(m.FaceData[3*t+(k+2)%3], PositionOffset), p))
+	d := math.Max(-1, math.Min(1, float64(dot3(a, b))))
+	return float32(math.Acos(d))
+}
+
+// positionIDs returns, for each vertex, an ID shared by all vertices at the
+// same position, and the number of distinct positions.
+func (m *Model) positionIDs() ([]int, int) {
+	ids := make([]int, m.VertexCount)
+	seen := make(map[[3]float32]int)
+	for i := range ids {
+		p := m.vec3(uint32(i), PositionOffset)
+		id, ok := seen[p]
+		if !ok {
+			id = len(seen)
+			seen[p] = id
+		}
+		ids[i] = id
+	}
+	return ids, len(seen)
+}
+
+func (m *Model) flatNormals(faces [][3]float32) {
+	data := make([]float32, 0, len(m.FaceData)*m.Stride)
+	for t := range faces {
+		n := normalize3(faces[t])
+		for k := 0; k < 3; k++ {
+			i := int(m.FaceData[3*t+k])
+			data = append(data, m.VertexData[i*m.Stride:(i+1)*m.Stride]...)
+			copy(data[len(data)-m.Stride+NormalOffset:], n[:])
+			m.FaceData[3*t+k] = uint32(3*t + k)
+		}
+	}
+	m.VertexData = data
+	m.VertexCount = len(data) / m.Stride
+}
+
+func (m *Model) smoothNormals(faces [][3]float32, byAngle bool) {
+	ids, n := m.positionIDs()
+	sums := make([][3]float32, n)
+	for t, fn := range faces {
+		if byAngle {
+			fn = normalize3(fn)
+		}
+		for k := 0; k < 3; k++ {
+			w := float32(1)
+			if byAngle {
+				w = m.cornerAngle(t, k)
+			}
+			s := &sums[ids[m.FaceData[3*t+k]]]
+			for j := range fn {
+				s[j] += w * fn[j]
+			}
+		}
+	}
+	for i, id := range ids {
+		m.setVec3(uint32(i), NormalOffset, normalize3(sums[id]))
+	}
+}
+
+func (m *Model) creaseNormals(faces [][3]float32, cosCrease float32) {
+	ids, n := m.positionIDs()
+	unit := make([][3]float32, len(faces))
+	around := make([][]int, n)
+	for t := range faces {
+		unit[t] = normalize3(faces[t])
+		for k := 0; k < 3; k++ {
+			id := ids[m.FaceData[3*t+k]]
+			around[id] = append(around[id], 3*t+k)
+		}
+	}
+
+	// Each corner averages the triangles around its position that are
+	// within the crease angle of its own triangle.  Vertices whose corners
+	// end up with different normals are split.
+	type key struct {
+		vertex uint32
+		normal [3]float32
+	}
+	split := make(map[key]uint32)
+	used := make([]bool, m.VertexCount)
+	for c, v := range m.FaceData {
+		t := c / 3
+		var sum [3]float32
+		for _, other := range around[ids[v]] {
+			u := other / 3
+			if dot3(unit[t], unit[u]) < cosCrease {
+				continue
+			}
+			w := m.cornerAngle(u, other%3)
+			for j := range sum {
+				sum[j] += w * unit[u][j]
+			}
+		}
+		k := key{v, normalize3(sum)}
+		if i, ok := split[k]; ok {
+			m.FaceData[c] = i
+			continue
+		}
+		i := v
+		if used[v] {
+			i = uint32(m.VertexCount)
+			m.VertexData = append(m.VertexData, m.VertexData[int(v)*m.Stride:int(v+1)*m.Stride]...)
+			m.VertexCount++
+		}
+		used[v] = true
+		m.setVec3(i, NormalOffset, k.normal)
+		split[k] = i
+		m.FaceData[c] = i
+	}
+}
+
+// vec3 returns the three floats at offset o of vertex i.
+func (m *Model) vec3(i uint32, o int) [3]float32 {
+	v := m.VertexData[int(i)*m.Stride+o:]
+	return [3]float32{v[0], v[1], v[2]}
+}
+
+func (m *Model) setVec3(i uint32, o int, v [3]float32) {
+	copy(m.VertexData[int(i)*m.Stride+o:], v[:])
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// objCube is a unit cube whose faces share its eight vertices.
+const objCube = `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+f 1 4 3 2
+f 5 6 7 8
+f 1 2 6 5
+f 2 3 7 6
+f 3 4 8 7
+f 4 1 5 8
+`
+
+func TestGenerateNormals(t *testing.T) {
+	diagonal := float32(1 / math.Sqrt(3))
+	tests := []struct {
+		mode     NormalMode
+		crease   float64
+		vertices int
+		// Absolute value of each component of every normal.
+		component []float32
+	}{
+		{FlatNormals, 0, 36, []float32{0, 1}},
+		{AngleNormals, 0, 8, []float32{diagonal}},
+		{CreaseNormals, 30, 24, []float32{0, 1}},
+		{CreaseNormals, 100, 8, []float32{diagonal}},
+	}
+	for _, test := range tests {
+		m := New()
+		if err := m.Load(strings.NewReader(objCube)); err != nil {
+			t.Fatal(err)
+		}
+		m.GenerateNormals(test.mode, test.crease)
+		if !m.HasNormals || m.VertexCount != test.vertices {
+			t.Errorf("%s %g: got %d vertices, want %d", test.mode, test.crease, m.VertexCount, test.vertices)
+			continue
+		}
+		for i := uint32(0); i < uint32(m.VertexCount); i++ {
+			n := m.vec3(i, NormalOffset)
+			for _, c := range n {
+				ok := false
+				for _, want := range test.component {
+					if d := float32(math.Abs(float64(c))) - want; d < 1e-5 && d > -1e-5 {
+						ok = true
+					}
+				}
+				if !ok {
+					t.Errorf("%s %g: vertex %d has normal %v, want components of %v", test.mode, test.crease, i, n, test.component)
+					break
+				}
+			}
+
+			// Normals point out of the cube.
+			p := m.vec3(i, PositionOffset)
+			if dot3(n, sub3(p, [3]float32{0.5, 0.5, 0.5})) <= 0 {
+				t.Errorf("%s %g: vertex %d at %v has normal %v pointing inwards", test.mode, test.crease, i, p, n)
+			}
+		}
+	}
+}
+
+func TestParseNormalMode(t *testing.T) {
+	for _, mode := range []NormalMode{FlatNormals, SmoothNormals, AngleNormals, CreaseNormals} {
+		if got, err := ParseNormalMode(mode.String()); err != nil || got != mode {
+			t.Errorf("ParseNormalMode(%q) = %v, %v, want %v", mode.String(), got, err, mode)
+		}
+	}
+	if _, err := ParseNormalMode("sharp"); err == nil {
+		t.Error("ParseNormalMode accepted an unknown mode")
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	RegisterFormat("obj", []string{".obj"}, "", decodeOBJ)
+	RegisterEncoder("obj", []string{".obj"}, encodeOBJ)
+}
+
+// objDecoder holds the state of a Wavefront OBJ file being read.
+type objDecoder struct {
+	m   *Model
+	dir string
+
+	positions [][3]float32
+	texCoords [][2]float32
+	normals   [][3]float32
+
+	// Output vertex index of each distinct position/texcoord/normal
+	// triple referenced by a face.
+	vertices map[[3]int]uint32
+
+	materials map[string]int
+	group     Group
+
+	allTexCoords bool
+	allNormals   bool
+
+	// Buffers reused for each line.
+	fields [][]byte
+	values []float32
+	poly   []uint32
+
+	polygons []int // Vertices of each face.
+}
+
+func decodeOBJ(m *Model, r io.Reader, dir string, opts LoadOptions) error {
+	d := objDecoder{
+		m:            m,
+		dir:          dir,
+		vertices:     make(map[[3]int]uint32),
+		materials:    make(map[string]int),
+		group:        Group{Material: -1, Transform: ident4(), Skin: -1, Node: -1},
+		allTexCoords: true,
+		allNormals:   true,
+	}
+	m.Format = "obj"
+
+	c := &countingReader{r: bufio.NewReaderSize(r, readBufferSize)}
+	for {
+		d.fields = d.fields[:0]
+		line, err := c.readLineBytes()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = d.parseLine(line)
+		}
+		if err != nil {
+			e := &ParseError{Format: "obj", Offset: c.start, Line: c.line, Index: -1, Err: err}
+			if len(d.fields) > 0 {
+				e.Element = string(d.fields[0])
+			}
+			return e
+		}
+	}
+	d.endGroup()
+
+	m.VertexCount = len(m.VertexData) / m.Stride
+	m.FaceCount = len(m.FaceData) / 3
+	m.Polygons = polygonCounts(d.polygons)
+	m.HasTexCoords = m.FaceCount > 0 && d.allTexCoords
+	m.HasNormals = m.FaceCount > 0 && d.allNormals
+	return nil
+}
+
+func (d *objDecoder) parseLine(line []byte) error {
+	if i := bytes.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	d.fields = splitFields(d.fields[:0], line)
+	if len(d.fields) == 0 {
+		return nil
+	}
+
+	args := d.fields[1:]
+	switch string(d.fields[0]) {
+	case "v":
+		v, err := d.parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		d.positions = append(d.positions, [3]float32{v[0], v[1], v[2]})
+	case "vt":
+		v, err := d.parseFloats(args, 1)
+		if err != nil {
+			return err
+		}
+		vt := [2]float32{v[0]}
+		if len(v) > 1 {
+			vt[1] = v[1]
+		}
+		d.texCoords = append(d.texCoords, vt)
+	case "vn":
+		v, err := d.parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		d.normals = append(d.normals, [3]float32{v[0], v[1], v[2]})
+	case "f":
+		return d.parseFace(args)
+	case "g", "o":
+		d.endGroup()
+		d.group.Name = string(bytes.Join(args, []byte(" ")))
+	case "usemtl":
+		d.endGroup()
+		d.group.Material = d.material(string(bytes.Join(args, []byte(" "))))
+	case "mtllib":
+		for _, name := range args {
+			if err := d.loadMaterials(string(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *objDecoder) parseFace(args [][]byte) error {
+	if len(args) < 3 {
+		return fmt.Errorf("face has %d vertices, expected at least 3", len(args))
+	}
+	d.poly = d.poly[:0]
+	for _, arg := range args {
+		key := [3]int{-1, -1, -1}
+		for j := 0; j < 3 && arg != nil; j++ {
+			s := arg
+			if k := bytes.IndexByte(arg, '/'); k >= 0 && j < 2 {
+				s, arg = arg[:k], arg[k+1:]
+			} else {
+				arg = nil
+			}
+			if len(s) == 0 {
+				continue
+			}
+			i, ok := parseInt(s, 32, true)
+			if !ok {
+				return fmt.Errorf("invalid face index %q", s)
+			}
+			n := int(i)
+			count := [3]int{len(d.positions), len(d.texCoords), len(d.normals)}[j]
+			if n < 0 {
+				n += count
+			} else {
+				n--
+			}
+			if n < 0 || n >= count {
+				return fmt.Errorf("face index %s out of range", s)
+			}
+			key[j] = n
+		}
+		v, err := d.vertex(key)
+		if err != nil {
+			return err
+		}
+		d.poly = append(d.poly, v)
+	}
+	d.m.FaceData = d.m.triangulate(d.m.FaceData, d.poly)
+	d.polygons = append(d.polygons, len(d.poly))
+	return nil
+}
+
+// vertex returns the output index of the vertex referencing the position,
+// texcoord and normal in key, adding it if needed.
+func (d *objDecoder) vertex(key [3]int) (uint32, error) {
+	if i, ok := d.vertices[key]; ok {
+		return i, nil
+	}
+	var v [VertexSize]float32
+	if key[0] < 0 {
+		return 0, fmt.Errorf("face vertex is missing a position")
+	}
+	copy(v[PositionOffset:], d.positions[key[0]][:])
+	if key[1] >= 0 {
+		copy(v[TexCoordOffset:], d.texCoords[key[1]][:])
+	} else {
+		d.allTexCoords = false
+	}
+	if key[2] >= 0 {
+		copy(v[NormalOffset:], d.normals[key[2]][:])
+	} else {
+		d.allNormals = false
+	}
+	i := uint32(len(d.m.VertexData) / d.m.Stride)
+	d.m.VertexData = append(d.m.VertexData, v[:]...)
+	d.vertices[key] = i
+	return i, nil
+}
+
+// endGroup closes the current group, keeping it if any faces were added.
+func (d *objDecoder) endGroup() {
+	first := len(d.m.FaceData) / 3
+	if d.group.Count = first - d.group.First; d.group.Count > 0 {
+		d.m.Groups = append(d.m.Groups, d.group)
+	}
+	d.group.First = first
+}
+
+// material returns the index of the named material, adding it if needed.
+func (d *objDecoder) material(name string) int {
+	if i, ok := d.materials[name]; ok {
+		return i
+	}
+	d.m.Materials = append(d.m.Materials, Material{Name: name})
+	d.materials[name] = len(d.m.Materials) - 1
+	return len(d.m.Materials) - 1
+}
+
+// loadMaterials reads the named MTL file.  A missing library is not an
+// error, the materials it would define are left without textures.
+func (d *objDecoder) loadMaterials(name string) error {
+	r, err := os.Open(d.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var mat *Material
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "newmtl" {
+			mat = &d.m.Materials[d.material(strings.Join(fields[1:], " "))]
+			continue
+		}
+		if mat == nil || len(fields) < 2 {
+			continue
+		}
+		// Texture options precede the filename, which is last.
+		filename := d.path(fields[len(fields)-1])
+		switch strings.ToLower(fields[0]) {
+		case "map_kd":
+			mat.ColorMap = filename
+		case "map_bump", "bump", "norm":
+			mat.NormalMap = filename
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &ParseError{File: d.path(name), Format: "mtl", Offset: -1, Index: -1, Err: err}
+	}
+	return nil
+}
+
+func (d *objDecoder) path(name string) string {
+	name = filepath.FromSlash(strings.Replace(name, "\\", "/", -1))
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(d.dir, name)
+}
+
+// parseFloats parses args as floats, requiring at least min values.  The
+// values are only valid until the next call.
+func (d *objDecoder) parseFloats(args [][]byte, min int) ([]float32, error) {
+	if len(args) < min {
+		return nil, fmt.Errorf("expected %d values, got %d", min, len(args))
+	}
+	d.values = d.values[:0]
+	for _, a := range args {
+		f, ok := parseFloat(a)
+		if !ok {
+			return nil, fmt.Errorf("invalid value %q", a)
+		}
+		if err := finite(float64(float32(f))); err != nil {
+			return nil, err
+		}
+		d.values = append(d.values, float32(f))
+	}
+	return d.values, nil
+}
+
+// encodeOBJ writes m as a Wavefront OBJ file.  Each group is written with
+// the name of its material, but no material library is written.
+func encodeOBJ(m Model, w io.Writer, ascii bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Created by shader-tool\n")
+	for i := 0; i < m.VertexCount; i++ {
+		p := m.vec3(uint32(i), PositionOffset)
+		fmt.Fprintf(bw, "v %g %g %g\n", p[0], p[1], p[2])
+	}
+	if m.HasTexCoords {
+		for i := 0; i < m.VertexCount; i++ {
+			u, v := m.texCoord(uint32(i))
+			fmt.Fprintf(bw, "vt %g %g\n", u, v)
+		}
+	}
+	if m.HasNormals {
+		for i := 0; i < m.VertexCount; i++ {
+			n := m.vec3(uint32(i), NormalOffset)
+			fmt.Fprintf(bw, "vn %g %g %g\n", n[0], n[1], n[2])
+		}
+	}
+
+	for _, g := range m.Parts() {
+		if g.Name != "" {
+			fmt.Fprintf(bw, "g %s\n", g.Name)
+		}
+		if g.Material >= 0 && g.Material < len(m.Materials) {
+			fmt.Fprintf(bw, "usemtl %s\n", m.Materials[g.Material].Name)
+		}
+		for t := g.First; t < g.First+g.Count; t++ {
+			bw.WriteString("f")
+			for k := 0; k < 3; k++ {
+				i := m.FaceData[3*t+k] + 1
+				switch {
+				case m.HasTexCoords && m.HasNormals:
+					fmt.Fprintf(bw, " %d/%d/%d", i, i, i)
+				case m.HasTexCoords:
+					fmt.Fprintf(bw, " %d/%d", i, i)
+				case m.HasNormals:
+					fmt.Fprintf(bw, " %d//%d", i, i)
+				default:
+					fmt.Fprintf(bw, " %d", i)
+				}
+			}
+			bw.WriteString("\n")
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadOBJ(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"quad.obj": `# Two groups sharing their edge.
+mtllib quad.mtl missing.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vn 0 0 1
+g first
+usemtl brick
+f 1/1/1 2/2/1 3/3/1
+g second
+usemtl plain
+f -4/-3/-1 -2/-1/-1 4/1/1
+`,
+		"quad.mtl": `newmtl brick
+map_Kd -s 2 2 2 textures\brick.png
+map_Bump brick_normal.png
+newmtl plain
+`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := New()
+	if err := m.LoadFile(filepath.Join(dir, "quad.obj")); err != nil {
+		t.Fatal(err)
+	}
+	if m.Format != "obj" || m.VertexCount != 4 || m.FaceCount != 2 {
+		t.Fatalf("got %s with %d vertices and %d faces, want obj with 4 and 2", m.Format, m.VertexCount, m.FaceCount)
+	}
+	if !m.HasNormals || !m.HasTexCoords {
+		t.Errorf("got normals %t and texture coordinates %t, want both", m.HasNormals, m.HasTexCoords)
+	}
+	// Corners referencing the same position, texture coordinates and
+	// normal share a vertex, whichever way they are indexed.
+	if want := []uint32{0, 1, 2, 0, 2, 3}; !reflect.DeepEqual(m.FaceData, want) {
+		t.Errorf("got faces %v, want %v", m.FaceData, want)
+	}
+
+	if len(m.Groups) != 2 || m.Groups[0].Name != "first" || m.Groups[1].Name != "second" || m.Groups[1].First != 1 {
+		t.Fatalf("got groups %+v, want first and second of a triangle each", m.Groups)
+	}
+	if len(m.Materials) != 2 {
+		t.Fatalf("got materials %+v, want brick and plain", m.Materials)
+	}
+	brick := m.Materials[m.Groups[0].Material]
+	if brick.Name != "brick" || brick.ColorMap != filepath.Join(dir, "textures", "brick.png") || brick.NormalMap != filepath.Join(dir, "brick_normal.png") {
+		t.Errorf("got material %+v, want brick with its color and normal maps", brick)
+	}
+	if plain := m.Materials[m.Groups[1].Material]; plain.Name != "plain" || plain.ColorMap != "" {
+		t.Errorf("got material %+v, want plain without textures", plain)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "sort"
+
+// ACMR returns the average number of vertices transformed per triangle when
+// drawing m through a FIFO post-transform cache holding cacheSize vertices.
+func (m Model) ACMR(cacheSize int) float64 {
+	if m.FaceCount == 0 {
+		return 0
+	}
+	return float64(cacheMisses(m.FaceData, m.VertexCount, cacheSize)) / float64(m.FaceCount)
+}
+
+// OptimizeTriangles reorders the triangles of each group for a vertex cache
+// holding cacheSize vertices, then orders the resulting clusters of
+// triangles so those facing outwards are drawn first, reducing overdraw.
+// This is the Tipsify algorithm of Sander, Nehab and Barczak, "Fast
+// Triangle Reordering for Vertex Locality and Reduced Overdraw".
+func (m *Model) OptimizeTriangles(cacheSize int) {
+	ranges := [][2]int{{0, m.FaceCount}}
+	if len(m.Groups) > 0 {
+		ranges = ranges[:0]
+		for _, g := range m.Groups {
+			ranges = append(ranges, [2]int{g.First, g.Count})
+		}
+	}
+	for _, r := range ranges {
+		tris := m.FaceData[3*r[0] : 3*(r[0]+r[1])]
+		order, hard := tipsify(tris, m.VertexCount, cacheSize)
+		order = m.sortClusters(tris, order, clusters(tris, order, hard, m.VertexCount, cacheSize))
+
+		sorted := make([]uint32, 0, len(tris))
+		for _, t := range order {
+			sorted = append(sorted, tris[3*t:3*t+3]...)
+		}
+		copy(tris, sorted)
+	}
+	// The triangles of a polygon are no longer together.
+	m.Polygons = nil
+}
+
+// OptimizeVertexFetch renumbers the vertices in the order the triangles
+// first use them, so they are fetched from memory sequentially.  Unused
+// vertices are moved to the end.
+func (m *Model) OptimizeVertexFetch() {
+	remap := make([]int, m.VertexCount)
+	for i := range remap {
+		remap[i] = -1
+	}
+	data := make([]float32, len(m.VertexData))
+	next := 0
+	move := func(v int) {
+		remap[v] = next
+		copy(data[next*m.Stride:], m.VertexData[v*m.Stride:(v+1)*m.Stride])
+		next++
+	}
+	for i, v := range m.FaceData {
+		if remap[v] < 0 {
+			move(int(v))
+		}
+		m.FaceData[i] = uint32(remap[v])
+	}
+	for v := range remap {
+		if remap[v] < 0 {
+			move(v)
+		}
+	}
+	m.VertexData = data
+}
+
+// cacheMisses returns the number of vertices of tris missing from a FIFO
+// cache of size k.
+func cacheMisses(tris []uint32, vertexCount, k int) int {
+	stamp := make([]int, vertexCount)
+	time, misses := k+1, 0
+	for _, v := range tris {
+		if time-stamp[v] > k {
+			stamp[v] = time
+			time++
+			misses++
+		}
+	}
+	return misses
+}
+
+// tipsify returns an order for the triangles tris optimized for a vertex
+// cache of size k, along with the positions in that order where the cache
+// is flushed by jumping to an unrelated part of the mesh.
+func tipsify(tris []uint32, vertexCount, k int) ([]int, []int) {
+	// Triangles using each vertex, and how many have yet to be emitted.
+	live := make([]int, vertexCount)
+	for _, v := range tris {
+		live[v]++
+	}
+	start := make([]int, vertexCount+1)
+	for v := 0; v < vertexCount; v++ {
+		start[v+1] = start[v] + live[v]
+	}
+	adjacent := make([]int, len(tris))
+	fill := append([]int(nil), start[:vertexCount]...)
+	for i, v := range tris {
+		adjacent[fill[v]] = i / 3
+		fill[v]++
+	}
+
+	stamp := make([]int, vertexCount)
+	emitted := make([]bool, len(tris)/3)
+	order := make([]int, 0, len(tris)/3)
+	var hard []int
+	var deadEnd, candidates []uint32
+	s, cursor := k+1, 0
+
+	// skipDeadEnd returns the most recently used vertex with triangles
+	// left, or failing that the next such vertex in index order.
+	skipDeadEnd := func() int {
+		for len(deadEnd) > 0 {
+			d := deadEnd[len(deadEnd)-1]
+			deadEnd = deadEnd[:len(deadEnd)-1]
+			if live[d] > 0 {
+				return int(d)
+			}
+		}
+		for ; cursor < vertexCount; cursor++ {
+			if live[cursor] > 0 {
+				return cursor
+			}
+		}
+		return -1
+	}
+
+	for f := skipDeadEnd(); f >= 0; {
+		candidates = candidates[:0]
+		for _, t := range adjacent[start[f]:start[f+1]] {
+			if emitted[t] {
+				continue
+			}
+			for _, v := range tris[3*t : 3*t+3] {
+				deadEnd = append(deadEnd, v)
+				candidates = append(candidates, v)
+				live[v]--
+				if s-stamp[v] > k {
+					stamp[v] = s
+					s++
+				}
+			}
+			emitted[t] = true
+			order = append(order, t)
+		}
+
+		// Fan around the candidate that will still be in the cache after
+		// its remaining triangles are emitted, preferring the oldest.
+		best, priority := -1, -1
+		for _, v := range candidates {
+			if live[v] == 0 {
+				continue
+			}
+			p := 0
+			if s-stamp[v]+2*live[v] <= k {
+				p = s - stamp[v]
+			}
+			if p > priority {
+				best, priority = int(v), p
+			}
+		}
+		if best < 0 {
+			best = skipDeadEnd()
+			hard = append(hard, len(order))
+		}
+		f = best
+	}
+	return order, hard
+}
+
+// clusters splits order into runs of triangles that can be drawn in any
+// order without greatly hurting the cache.  Runs start at each hard
+// boundary, and wherever the cache misses of the current run fall below the
+// average of the whole order.
+func clusters(tris []uint32, order, hard []int, vertexCount, k int) []int {
+	if len(order) == 0 {
+		return nil
+	}
+	sorted := make([]uint32, 0, len(tris))
+	for _, t := range order {
+		sorted = append(sorted, tris[3*t:3*t+3]...)
+	}
+	average := float64(cacheMisses(sorted, vertexCount, k)) / float64(len(order))
+
+	starts := []int{0}
+	stamp := make([]int, vertexCount)
+	time, misses := k+1, 0
+	for i := range order {
+		if len(hard) > 0 && hard[0] <= i {
+			hard = hard[1:]
+			if i > starts[len(starts)-1] {
+				starts = append(starts, i)
+				misses = 0
+			}
+		} else if n := i - starts[len(starts)-1]; n > 0 && float64(misses)/float64(n) < average {
+			starts = append(starts, i)
+			misses = 0
+		}
+		for _, v := range sorted[3*i : 3*i+3] {
+			if time-stamp[v] > k {
+				stamp[v] = time
+				time++
+				misses++
+			}
+		}
+	}
+	return starts
+}
+
+// sortClusters returns order with its clusters, starting at the given
+// positions, sorted so those facing away from the center of the mesh come
+// first.
+func (m *Model) sortClusters(tris []uint32, order, starts []int) []int {
+	type cluster struct {
+		triangles []int
+		centroid  [3]float32
+		normal    [3]float32
+		area      float32
+	}
+	cs := make([]cluster, len(starts))
+	var center [3]float32
+	var area float32
+	for i, s := range starts {
+		end := len(order)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		c := &cs[i]
+		c.triangles = order[s:end]
+		for _, t := range c.triangles {
+			a := m.vec3(tris[3*t], PositionOffset)
+			b := m.vec3(tris[3*t+1], PositionOffset)
+			d := m.vec3(tris[3*t+2], PositionOffset)
+			n := cross3(sub3(b, a), sub3(d, a))
+			w := length3(n)
+			for k := range c.centroid {
+				c.centroid[k] += w * (a[k] + b[k] + d[k]) / 3
+				c.normal[k] += n[k]
+			}
+			c.area += w
+		}
+		for k := range center {
+			center[k] += c.centroid[k]
+		}
+		area += c.area
+		if c.area > 0 {
+			for k := range c.centroid {
+				c.centroid[k] /= c.area
+			}
+		}
+	}
+	if area > 0 {
+		for k := range center {
+			center[k] /= area
+		}
+	}
+
+	metric := make([]float32, len(cs))
+	for i, c := range cs {
+		metric[i] = dot3(sub3(c.centroid, center), normalize3(c.normal))
+	}
+	indices := make([]int, len(cs))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		return metric[indices[a]] > metric[indices[b]]
+	})
+
+	sorted := make([]int, 0, len(order))
+	for _, i := range indices {
+		sorted = append(sorted, cs[i].triangles...)
+	}
+	return sorted
+}
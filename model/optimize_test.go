@@ -0,0 +1,93 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// triangleSet counts the triangles of m by the positions of their corners,
+// taken in whichever rotation sorts first so rotated triangles are counted
+// together.
+func triangleSet(m Model) map[[9]float32]int {
+	set := make(map[[9]float32]int)
+	for t := 0; t < m.FaceCount; t++ {
+		var best [9]float32
+		for r := 0; r < 3; r++ {
+			var key [9]float32
+			for k := 0; k < 3; k++ {
+				p := m.vec3(m.FaceData[3*t+(r+k)%3], PositionOffset)
+				copy(key[3*k:], p[:])
+			}
+			if r == 0 || lessKey(key, best) {
+				best = key
+			}
+		}
+		set[best]++
+	}
+	return set
+}
+
+// lessKey reports whether a sorts before b.
+func lessKey(a, b [9]float32) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func TestOptimize(t *testing.T) {
+	m := New()
+	if err := m.LoadFile(BuiltinPrefix + "torus?segments=64&rings=32"); err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	r.Shuffle(m.FaceCount, func(i, j int) {
+		for k := 0; k < 3; k++ {
+			m.FaceData[3*i+k], m.FaceData[3*j+k] = m.FaceData[3*j+k], m.FaceData[3*i+k]
+		}
+	})
+	before := m.ACMR(16)
+	want := triangleSet(m)
+
+	m.OptimizeTriangles(16)
+	if after := m.ACMR(16); after >= before || after > 1 {
+		t.Errorf("ACMR went from %.3f to %.3f, want below 1", before, after)
+	}
+	m.OptimizeVertexFetch()
+
+	// Vertices are numbered in the order they are first used.
+	next := uint32(0)
+	for _, v := range m.FaceData {
+		if v > next {
+			t.Fatalf("vertex %d is used before vertex %d", v, next)
+		}
+		if v == next {
+			next++
+		}
+	}
+	got := triangleSet(m)
+	if len(got) != len(want) {
+		t.Fatalf("got %d distinct triangles, want %d", len(got), len(want))
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Fatalf("triangle %v is drawn %d times, want %d", k, got[k], n)
+		}
+	}
+}
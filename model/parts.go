@@ -0,0 +1,126 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// Parts returns the groups of m, or a single group holding every triangle,
+// deformed by every morph target, if it has none.
+func (m Model) Parts() []Group {
+	if len(m.Groups) > 0 {
+		return m.Groups
+	}
+	return []Group{{Material: -1, Count: m.FaceCount, Transform: ident4(), Skin: -1, MorphCount: len(m.Morphs), Node: -1}}
+}
+
+// Mirrored reports whether the transform of g mirrors its triangles, so
+// they must be drawn with the opposite winding to face the front.
+func (g Group) Mirrored() bool {
+	return det3(g.Transform) < 0
+}
+
+// HasTransforms reports whether any group of m has a transform other than
+// the identity.
+func (m Model) HasTransforms() bool {
+	for _, g := range m.Groups {
+		if g.Transform != ident4() {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultTransforms sets the transform of groups a decoder left unset to
+// the identity.
+func (m *Model) defaultTransforms() {
+	for i := range m.Groups {
+		if m.Groups[i].Transform == [16]float32{} {
+			m.Groups[i].Transform = ident4()
+		}
+	}
+}
+
+// Bake applies the transform of each group to the vertices it uses, then
+// resets the transform to the identity.  Vertices shared by groups with
+// different transforms are copied, and the triangles of groups with
+// mirroring transforms have their winding reversed so they remain front
+// facing.
+func (m *Model) Bake() {
+	if !m.HasTransforms() {
+		return
+	}
+	type key struct {
+		vertex    uint32
+		transform [16]float32
+	}
+	baked := make(map[key]uint32)
+	used := make([]bool, m.VertexCount)
+	original := append([]float32(nil), m.VertexData...)
+	deltas := m.morphDeltas()
+	for gi := range m.Groups {
+		g := &m.Groups[gi]
+		n := normalMatrix(g.Transform)
+		for c := 3 * g.First; c < 3*(g.First+g.Count); c++ {
+			k := key{m.FaceData[c], g.Transform}
+			if int(k.vertex) >= len(used) {
+				continue
+			}
+			i, ok := baked[k]
+			if !ok {
+				i = k.vertex
+				if used[i] {
+					i = uint32(m.VertexCount)
+					m.VertexData = append(m.VertexData, original[int(k.vertex)*m.Stride:int(k.vertex+1)*m.Stride]...)
+					m.VertexCount++
+				} else {
+					used[i] = true
+				}
+				m.transformVertex(i, g.Transform, n, deltas)
+				baked[k] = i
+			}
+			m.FaceData[c] = i
+		}
+		if g.Mirrored() {
+			for t := g.First; t < g.First+g.Count; t++ {
+				m.FaceData[3*t+1], m.FaceData[3*t+2] = m.FaceData[3*t+2], m.FaceData[3*t+1]
+			}
+		}
+		g.Transform = ident4()
+	}
+}
+
+// eachPosition calls f with the model space position of each vertex, once
+// for every distinct transform of the groups using it.  Vertices no group
+// uses are skipped when groups have transforms.
+func (m Model) eachPosition(f func(p [3]float32)) {
+	if !m.HasTransforms() {
+		for i := 0; i < m.VertexCount; i++ {
+			f(m.vec3(uint32(i), PositionOffset))
+		}
+		return
+	}
+	type key struct {
+		vertex    uint32
+		transform [16]float32
+	}
+	seen := make(map[key]bool)
+	for _, g := range m.Groups {
+		for _, v := range m.FaceData[3*g.First : 3*(g.First+g.Count)] {
+			k := key{v, g.Transform}
+			if int(v) < m.VertexCount && !seen[k] {
+				seen[k] = true
+				f(transformPoint(g.Transform, m.vec3(v, PositionOffset)))
+			}
+		}
+	}
+}
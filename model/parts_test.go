@@ -0,0 +1,67 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParts(t *testing.T) {
+	m := savedModel()
+	parts := m.Parts()
+	if len(parts) != 1 || parts[0].Count != m.FaceCount || parts[0].Material != -1 || parts[0].Transform != ident4() {
+		t.Errorf("got parts %+v, want one of every triangle", parts)
+	}
+}
+
+func TestBake(t *testing.T) {
+	// One triangle placed twice, the second time mirrored.
+	js, _ := gltfTriangle([]uint16{0, 1, 2}, true)
+	js = strings.Replace(js, `"nodes": [{"mesh": 0}],
+  "scenes": [{"nodes": [0]}]`, `"nodes": [{"mesh": 0, "translation": [0, 0, 1]}, {"mesh": 0, "scale": [-1, 1, 1]}],
+  "scenes": [{"nodes": [0, 1]}]`, 1)
+	m := New()
+	if err := m.Load(strings.NewReader(js)); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Groups) != 2 || !m.HasTransforms() || m.Groups[0].Mirrored() || !m.Groups[1].Mirrored() {
+		t.Fatalf("got groups %+v, want the triangle placed twice, mirrored the second time", m.Groups)
+	}
+
+	m.Bake()
+	if m.HasTransforms() {
+		t.Error("groups keep their transforms after baking")
+	}
+	if m.VertexCount != 6 {
+		t.Errorf("got %d vertices, want the 3 shared by both groups copied", m.VertexCount)
+	}
+	// The corner at X 1 is moved by each transform, and is last in the
+	// mirrored triangle, whose winding is reversed.
+	for g, want := range []struct {
+		corner int
+		p      [3]float32
+	}{{1, [3]float32{1, 0, 1}}, {2, [3]float32{-1, 0, 0}}} {
+		f := m.FaceData[3*g : 3*g+3]
+		a, b, c := m.vec3(f[0], PositionOffset), m.vec3(f[1], PositionOffset), m.vec3(f[2], PositionOffset)
+		if p := m.vec3(f[want.corner], PositionOffset); p != want.p {
+			t.Errorf("group %d has corner %d at %v, want %v", g, want.corner, p, want.p)
+		}
+		// Both triangles still face +Z.
+		if n := cross3(sub3(b, a), sub3(c, a)); n[2] <= 0 {
+			t.Errorf("group %d faces %v, want +Z", g, n)
+		}
+	}
+}
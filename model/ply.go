@@ -0,0 +1,575 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func init() {
+	RegisterFormat("ply", []string{".ply"}, "ply", decodePLY)
+	RegisterEncoder("ply", []string{".ply"}, encodePLY)
+}
+
+var Formats = [...]string{
+	"format ascii 1.0",
+	"format binary_little_endian 1.0",
+	"format binary_big_endian 1.0",
+}
+
+// vertexProperties maps PLY vertex property names to their offset within a
+// vertex.  Other scalar properties are kept as extra attributes.
+var vertexProperties = map[string]int{
+	"x":         PositionOffset,
+	"y":         PositionOffset + 1,
+	"z":         PositionOffset + 2,
+	"nx":        NormalOffset,
+	"ny":        NormalOffset + 1,
+	"nz":        NormalOffset + 2,
+	"s":         TexCoordOffset,
+	"t":         TexCoordOffset + 1,
+	"u":         TexCoordOffset,
+	"v":         TexCoordOffset + 1,
+	"texture_s": TexCoordOffset,
+	"texture_t": TexCoordOffset + 1,
+	"texture_u": TexCoordOffset,
+	"texture_v": TexCoordOffset + 1,
+	"tx":        TangentOffset,
+	"ty":        TangentOffset + 1,
+	"tz":        TangentOffset + 2,
+	"tw":        TangentOffset + 3,
+}
+
+// colorProperties maps PLY vertex color property names to their component
+// of the color attribute.
+var colorProperties = map[string]int{
+	"red":           0,
+	"green":         1,
+	"blue":          2,
+	"alpha":         3,
+	"diffuse_red":   0,
+	"diffuse_green": 1,
+	"diffuse_blue":  2,
+	"diffuse_alpha": 3,
+}
+
+// texCoord1Properties maps PLY property names of a second set of texture
+// coordinates to their component of that attribute.
+var texCoord1Properties = map[string]int{
+	"s1":         0,
+	"t1":         1,
+	"u1":         0,
+	"v1":         1,
+	"texture_s1": 0,
+	"texture_t1": 1,
+	"texture_u1": 0,
+	"texture_v1": 1,
+}
+
+// colorMax holds the values of full intensity integer color components,
+// which are divided by it to the range 0 to 1.  Other types are used as
+// they are.
+var colorMax = map[plyType]float64{
+	plyUchar:  0xff,
+	plyUshort: 0xffff,
+}
+
+// element describes an element declared in a PLY header.
+type element struct {
+	name       string
+	count      int
+	properties []property
+}
+
+// property describes a property of a PLY element.  For list properties,
+// countType is the type of the leading count and typ the type of each item.
+type property struct {
+	name      string
+	typ       plyType
+	list      bool
+	countType plyType
+}
+
+// plyDecoder holds the state of a PLY file being read.
+type plyDecoder struct {
+	m       *Model
+	c       *countingReader
+	vr      valueReader
+	workers int // Goroutines parsing text records.
+}
+
+func decodePLY(m *Model, r io.Reader, dir string, opts LoadOptions) error {
+	d := plyDecoder{m: m, c: &countingReader{r: bufio.NewReaderSize(r, readBufferSize)}, workers: opts.workers()}
+
+	elements, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	var polygons []uint32
+	var counts []int
+	d.vr = newValueReader(d.c, m.Format)
+	for _, e := range elements {
+		switch e.name {
+		case "vertex":
+			err = d.readVertices(e)
+		case "face":
+			polygons, counts, err = d.readFaces(e)
+		default:
+			err = d.skipElement(e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := d.vr.end(); err != nil {
+		return d.fail("", -1, "", err)
+	}
+
+	if err := m.setFaces(polygons, counts); err != nil {
+		return &ParseError{Format: "ply", Offset: -1, Element: "face", Index: -1, Err: err}
+	}
+	m.findMorphs()
+
+	return nil
+}
+
+// vectorProperty splits the name of a property Save wrote for a component
+// of a vector attribute, such as "Joints0_2", into the name of the
+// attribute and the component.
+func vectorProperty(name string) (string, int, bool) {
+	i := len(name) - 2
+	if i < 1 || name[i] != '_' || name[i+1] < '0' || name[i+1] > '3' {
+		return "", 0, false
+	}
+	return name[:i], int(name[i+1] - '0'), true
+}
+
+// fail returns err as a ParseError at the current position.  Lines are only
+// given for text, the data of binary files is located by offset alone.
+func (d *plyDecoder) fail(element string, index int, property string, err error) error {
+	e := &ParseError{
+		Format:   "ply",
+		Offset:   d.c.start,
+		Element:  element,
+		Index:    index,
+		Property: property,
+		Err:      err,
+	}
+	if _, ok := d.vr.(*binaryReader); !ok {
+		e.Line = d.c.line
+	}
+	return e
+}
+
+func (d *plyDecoder) readHeader() ([]element, error) {
+	// Magic
+	if magic, err := d.c.readLine(); err != nil || magic != "ply" {
+		return nil, d.fail("", -1, "", fmt.Errorf("invalid ply file, expected 'ply' got '%s'", magic))
+	}
+
+	// format/version
+	format, err := d.c.readLine()
+	if err != nil {
+		return nil, d.fail("", -1, "", fmt.Errorf("trouble reading format: %s", err))
+	}
+	d.m.Format = strings.Join(strings.Fields(format), " ")
+	supported := false
+	for i := range Formats {
+		if d.m.Format == Formats[i] {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, d.fail("", -1, "", fmt.Errorf("unsupported format: %s", d.m.Format))
+	}
+
+	var elements []element
+	declared := make(map[string]bool)
+	for {
+		line, err := d.c.readLine()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, d.fail("", -1, "", fmt.Errorf("trouble scanning header: %s", err))
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "end_header":
+			return elements, nil
+		case "comment", "obj_info":
+		case "element":
+			if len(fields) != 3 {
+				return nil, d.fail("", -1, "", fmt.Errorf("trouble scanning element: %s", line))
+			}
+			c, err := strconv.Atoi(fields[2])
+			if err != nil || c < 0 || c > maxElementCount {
+				return nil, d.fail(fields[1], -1, "", fmt.Errorf("invalid element count: %s", fields[2]))
+			}
+			if declared[fields[1]] {
+				return nil, d.fail(fields[1], -1, "", fmt.Errorf("element declared twice"))
+			}
+			declared[fields[1]] = true
+			elements = append(elements, element{name: fields[1], count: c})
+			if fields[1] == "vertex" {
+				d.m.VertexCount = c
+			} else if fields[1] == "face" {
+				d.m.FaceCount = c
+			}
+		case "property":
+			if len(elements) == 0 {
+				return nil, d.fail("", -1, "", fmt.Errorf("property declared before any element: %s", line))
+			}
+			e := &elements[len(elements)-1]
+			p, err := parseProperty(line)
+			if err != nil {
+				return nil, d.fail(e.name, -1, "", err)
+			}
+			e.properties = append(e.properties, p)
+		default:
+			return nil, d.fail("", -1, "", fmt.Errorf("unexpected header line: %s", line))
+		}
+	}
+}
+
+func parseProperty(line string) (property, error) {
+	fields := strings.Fields(line)
+	var p property
+	var typ, countType string
+	switch {
+	case len(fields) == 3 && fields[1] != "list":
+		p.name, typ = fields[2], fields[1]
+	case len(fields) == 5 && fields[1] == "list":
+		p.name, typ, countType, p.list = fields[4], fields[3], fields[2], true
+		var ok bool
+		if p.countType, ok = plyTypes[countType]; !ok {
+			return p, fmt.Errorf("unsupported property type: %s", countType)
+		}
+	default:
+		return p, fmt.Errorf("trouble scanning property: %s", line)
+	}
+	var ok bool
+	if p.typ, ok = plyTypes[typ]; !ok {
+		return p, fmt.Errorf("unsupported property type: %s", typ)
+	}
+	return p, nil
+}
+
+func (d *plyDecoder) readVertices(e element) error {
+	m := d.m
+	offsets := make([]int, len(e.properties))
+	divisors := make([]float64, len(e.properties))
+	found := make(map[int]bool)
+	vectors := make(map[string]int) // Size of each vector attribute.
+	for _, p := range e.properties {
+		if name, k, ok := vectorProperty(p.name); ok && !p.list && k >= vectors[name] {
+			vectors[name] = k + 1
+		}
+	}
+	for i, p := range e.properties {
+		offsets[i], divisors[i] = -1, 1
+		if p.list {
+			continue
+		}
+		if o, ok := vertexProperties[p.name]; ok {
+			offsets[i] = o
+			found[o] = true
+			continue
+		}
+
+		// Colors, a second set of texture coordinates, the components of
+		// vectors Save wrote and any other scalar properties are added as
+		// extra attributes.
+		if c, ok := colorProperties[p.name]; ok {
+			offsets[i] = m.AddAttribute(ColorAttribute, 4).Offset + c
+			if max, ok := colorMax[p.typ]; ok {
+				divisors[i] = max
+			}
+		} else if c, ok := texCoord1Properties[p.name]; ok {
+			offsets[i] = m.AddAttribute(TexCoord1Attribute, 2).Offset + c
+		} else if name, k, ok := vectorProperty(p.name); ok && vectors[name] > 1 {
+			if a := m.AddAttribute(name, vectors[name]); k < a.Size {
+				offsets[i] = a.Offset + k
+			}
+		} else if _, ok := m.Attribute(p.name); !ok {
+			offsets[i] = m.AddAttribute(p.name, 1).Offset
+		}
+	}
+	for o := PositionOffset; o < PositionOffset+3; o++ {
+		if !found[o] {
+			return d.fail(e.name, -1, "", fmt.Errorf("vertex is missing x, y or z property"))
+		}
+	}
+	m.HasNormals = found[NormalOffset] && found[NormalOffset+1] && found[NormalOffset+2]
+	m.HasTexCoords = found[TexCoordOffset] && found[TexCoordOffset+1]
+	m.HasTangents = found[TangentOffset] && found[TangentOffset+1] && found[TangentOffset+2] && found[TangentOffset+3]
+
+	// The vertices of each chunk of records are only allocated once it is
+	// read, so counts larger than the file holds fail at its end rather
+	// than allocating for them up front.
+	chunks := make([][]float32, (e.count+chunkRecords-1)/chunkRecords)
+	def := m.defaultVertex()
+	err := d.readRecords(e, func(d *plyDecoder, chunk, i int) error {
+		if chunks[chunk] == nil {
+			n := e.count - chunk*chunkRecords
+			if n > chunkRecords {
+				n = chunkRecords
+			}
+			chunks[chunk] = make([]float32, 0, n*m.Stride)
+			for k := 0; k < n; k++ {
+				chunks[chunk] = append(chunks[chunk], def...)
+			}
+		}
+		vertex := chunks[chunk][(i-chunk*chunkRecords)*m.Stride:]
+		for j, p := range e.properties {
+			if offsets[j] < 0 {
+				if err := skipProperty(d.vr, p); err != nil {
+					return d.fail(e.name, i, p.name, err)
+				}
+				continue
+			}
+			v, err := d.vr.read(p.typ)
+			if err != nil {
+				return d.fail(e.name, i, p.name, err)
+			}
+			f := float32(v / divisors[j])
+			if err := finite(float64(f)); err != nil {
+				return d.fail(e.name, i, p.name, err)
+			}
+			vertex[offsets[j]] = f
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.VertexData = make([]float32, 0, m.Stride*e.count)
+	for _, c := range chunks {
+		m.VertexData = append(m.VertexData, c...)
+	}
+	return nil
+}
+
+// readFaces returns the vertex indices of each face, concatenated, and the
+// number of vertices in each face.
+func (d *plyDecoder) readFaces(e element) ([]uint32, []int, error) {
+	// Each chunk of records collects its own indices, as the number of
+	// indices preceding a chunk is not known until the earlier ones are
+	// read.
+	chunks := make([][]uint32, (e.count+chunkRecords-1)/chunkRecords)
+	chunkCounts := make([][]int, len(chunks))
+	err := d.readRecords(e, func(d *plyDecoder, chunk, i int) error {
+		if chunks[chunk] == nil {
+			chunks[chunk] = make([]uint32, 0, 3*chunkRecords)
+		}
+		count := 0
+		for _, p := range e.properties {
+			if !p.list || (p.name != "vertex_indices" && p.name != "vertex_index") {
+				if err := skipProperty(d.vr, p); err != nil {
+					return d.fail(e.name, i, p.name, err)
+				}
+				continue
+			}
+			c, err := d.vr.read(p.countType)
+			if err != nil {
+				return d.fail(e.name, i, p.name, err)
+			}
+			if c < 3 {
+				return d.fail(e.name, i, p.name, fmt.Errorf("face has %d vertices, expected at least 3", int(c)))
+			}
+			count = int(c)
+			for j := 0; j < int(c); j++ {
+				v, err := d.vr.read(p.typ)
+				if err != nil {
+					return d.fail(e.name, i, p.name, err)
+				}
+				if v < 0 || v >= float64(d.m.VertexCount) || v != math.Trunc(v) {
+					return d.fail(e.name, i, p.name, fmt.Errorf("vertex index %v out of range", v))
+				}
+				chunks[chunk] = append(chunks[chunk], uint32(v))
+			}
+		}
+		if count == 0 {
+			return d.fail(e.name, i, "", fmt.Errorf("face has no vertex_indices property"))
+		}
+		chunkCounts[chunk] = append(chunkCounts[chunk], count)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := 0
+	for _, c := range chunks {
+		n += len(c)
+	}
+	polygons := make([]uint32, 0, n)
+	counts := make([]int, 0, e.count)
+	for i, c := range chunks {
+		polygons = append(polygons, c...)
+		counts = append(counts, chunkCounts[i]...)
+	}
+	return polygons, counts, nil
+}
+
+func (d *plyDecoder) skipElement(e element) error {
+	return d.readRecords(e, func(d *plyDecoder, chunk, i int) error {
+		for _, p := range e.properties {
+			if err := skipProperty(d.vr, p); err != nil {
+				return d.fail(e.name, i, p.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// chunkRecords is the number of text records parsed together by a worker.
+const chunkRecords = 16384
+
+// maxElementCount is the largest number of records an element may declare.
+const maxElementCount = math.MaxInt32
+
+// recordChunk holds the lines of consecutive text records, and where they
+// were found.
+type recordChunk struct {
+	index  int // Index of the chunk within the element.
+	first  int // Index of the first record.
+	count  int // Number of records.
+	data   []byte
+	offset int64 // Offset of data within the file.
+	line   int   // Number of lines preceding data.
+}
+
+// readRecords calls parse for each record of e in turn, with chunk the
+// index of the chunk of chunkRecords records it is in.  The records of
+// large elements of text files are split into chunks parsed concurrently,
+// each with its own decoder, so parse must only touch the data of record
+// i and chunk.  The first error in the file is returned.
+func (d *plyDecoder) readRecords(e element, parse func(d *plyDecoder, chunk, i int) error) error {
+	if _, ok := d.vr.(*asciiReader); !ok || d.workers <= 1 || e.count <= chunkRecords {
+		for i := 0; i < e.count; i++ {
+			if err := d.vr.next(); err != nil {
+				return d.fail(e.name, i, "", err)
+			}
+			if err := parse(d, i/chunkRecords, i); err != nil {
+				return err
+			}
+			if err := d.vr.done(); err != nil {
+				return d.fail(e.name, i, "", err)
+			}
+		}
+		return nil
+	}
+
+	chunks := make(chan recordChunk, d.workers)
+	errs := make([]error, (e.count+chunkRecords-1)/chunkRecords)
+	var wg sync.WaitGroup
+	for w := 0; w < d.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				errs[c.index] = d.parseChunk(e, c, parse)
+			}
+		}()
+	}
+
+	// Lines are copied into chunks here, leaving the parsing to the
+	// workers.
+	var err error
+	for first := 0; first < e.count && err == nil; first += chunkRecords {
+		c := recordChunk{index: first / chunkRecords, first: first, offset: d.c.offset, line: d.c.line}
+		c.count = e.count - first
+		if c.count > chunkRecords {
+			c.count = chunkRecords
+		}
+		for i := 0; i < c.count; {
+			var line []byte
+			if line, err = d.c.readRawLine(); err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				// Records read before the error may hold earlier ones.
+				err = d.fail(e.name, first+i, "", err)
+				c.count = i
+				break
+			}
+			c.data = append(c.data, line...)
+			if !isBlank(line) {
+				i++
+			}
+		}
+		chunks <- c
+	}
+	close(chunks)
+	wg.Wait()
+
+	for _, chunkErr := range errs {
+		if chunkErr != nil {
+			return chunkErr
+		}
+	}
+	return err
+}
+
+// parseChunk parses the records of c with a decoder of its own.
+func (d *plyDecoder) parseChunk(e element, c recordChunk, parse func(d *plyDecoder, chunk, i int) error) error {
+	cr := &countingReader{r: bufio.NewReader(bytes.NewReader(c.data)), offset: c.offset, line: c.line}
+	cd := &plyDecoder{m: d.m, c: cr, vr: &asciiReader{c: cr}}
+	for i := c.first; i < c.first+c.count; i++ {
+		if err := cd.vr.next(); err != nil {
+			return cd.fail(e.name, i, "", err)
+		}
+		if err := parse(cd, c.index, i); err != nil {
+			return err
+		}
+		if err := cd.vr.done(); err != nil {
+			return cd.fail(e.name, i, "", err)
+		}
+	}
+	return nil
+}
+func skipProperty(vr valueReader, p property) error {
+	if p.list {
+		return skipList(vr, p)
+	}
+	_, err := vr.read(p.typ)
+	return err
+}
+
+func skipList(vr valueReader, p property) error {
+	c, err := vr.read(p.countType)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < int(c); j++ {
+		if _, err := vr.read(p.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
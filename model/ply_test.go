@@ -0,0 +1,174 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// largePLY returns an ASCII PLY file with enough vertices and faces to be
+// parsed in several chunks.
+func largePLY(t testing.TB) []byte {
+	m := New()
+	if err := m.LoadFile(BuiltinPrefix + "torus?segments=256&rings=128"); err != nil {
+		t.Fatal(err)
+	}
+	if m.VertexCount <= 2*chunkRecords || m.FaceCount <= 2*chunkRecords {
+		t.Fatalf("got %d vertices and %d faces, want more than %d", m.VertexCount, m.FaceCount, 2*chunkRecords)
+	}
+	var buf bytes.Buffer
+	if err := m.Save(&buf, "ascii"); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadPLYWorkers(t *testing.T) {
+	data := largePLY(t)
+	want := New()
+	if err := want.LoadWith(bytes.NewReader(data), LoadOptions{Workers: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 3, 8} {
+		got := New()
+		if err := got.LoadWith(bytes.NewReader(data), LoadOptions{Workers: workers}); err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: model differs from the one parsed by one worker", workers)
+		}
+	}
+
+	// Errors in later chunks must not hide the first one.
+	lines := bytes.Split(data, []byte("\n"))
+	header := bytes.Count(data[:bytes.Index(data, []byte("end_header"))], []byte("\n")) + 1
+	for _, i := range []int{header + chunkRecords + 5, header + 2*chunkRecords + 7} {
+		lines[i] = []byte("0 x 0")
+	}
+	data = bytes.Join(lines, []byte("\n"))
+	m := New()
+	wantErr := m.LoadWith(bytes.NewReader(data), LoadOptions{Workers: 1})
+	if wantErr == nil {
+		t.Fatal("corrupt file loaded")
+	}
+	for _, workers := range []int{2, 8} {
+		if err := m.LoadWith(bytes.NewReader(data), LoadOptions{Workers: workers}); err == nil || err.Error() != wantErr.Error() {
+			t.Errorf("%d workers: got error %v, want %v", workers, err, wantErr)
+		}
+	}
+}
+
+func TestLoadBinaryPLY(t *testing.T) {
+	header := `ply
+format %s 1.0
+comment mixed property types
+element vertex 3
+property double x
+property float y
+property short z
+element face 1
+property list uchar ushort vertex_indices
+element edge 2
+property list int float values
+end_header
+`
+	want := New()
+	ascii := fmt.Sprintf(header, "ascii") + "0 0 0\n1.5 0 -2\n0 1 7\n3 0 1 2\n1 0.5\n2 1 2\n"
+	if err := want.Load(strings.NewReader(ascii)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		format := "binary_little_endian"
+		if order == binary.BigEndian {
+			format = "binary_big_endian"
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, header, format)
+		for _, v := range [][3]float64{{0, 0, 0}, {1.5, 0, -2}, {0, 1, 7}} {
+			binary.Write(&buf, order, v[0])
+			binary.Write(&buf, order, float32(v[1]))
+			binary.Write(&buf, order, int16(v[2]))
+		}
+		buf.WriteByte(3)
+		binary.Write(&buf, order, []uint16{0, 1, 2})
+		binary.Write(&buf, order, int32(1))
+		binary.Write(&buf, order, float32(0.5))
+		binary.Write(&buf, order, int32(2))
+		binary.Write(&buf, order, []float32{1, 2})
+
+		got := New()
+		if err := got.Load(&buf); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !reflect.DeepEqual(got.VertexData, want.VertexData) || !reflect.DeepEqual(got.FaceData, want.FaceData) {
+			t.Errorf("%s: got vertices %v and faces %v, want %v and %v", format, got.VertexData, got.FaceData, want.VertexData, want.FaceData)
+		}
+		if want := "format " + format + " 1.0"; got.Format != want {
+			t.Errorf("got format %q, want %q", got.Format, want)
+		}
+	}
+}
+
+func TestPLYPropertyMapping(t *testing.T) {
+	data := `ply
+format ascii 1.0
+element vertex 3
+property float nz
+property float v
+property float x
+property float ny
+property float u
+property float y
+property float nx
+property float z
+element face 1
+property list uchar int vertex_index
+end_header
+1 0.25 0 0 0.5 0 0 0
+1 0.25 1 0 0.75 0 0 0
+1 0.5 0 0 0.5 1 0 0
+3 0 1 2
+`
+	m := New()
+	if err := m.Load(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasNormals || !m.HasTexCoords || m.HasTangents {
+		t.Errorf("got normals %t, texture coordinates %t, tangents %t, want normals and texture coordinates", m.HasNormals, m.HasTexCoords, m.HasTangents)
+	}
+	if p := m.vec3(1, PositionOffset); p != [3]float32{1, 0, 0} {
+		t.Errorf("vertex 1 is at %v, want [1 0 0]", p)
+	}
+	if n := m.vec3(2, NormalOffset); n != [3]float32{0, 0, 1} {
+		t.Errorf("vertex 2 has normal %v, want [0 0 1]", n)
+	}
+	if u, v := m.texCoord(1); u != 0.75 || v != 0.25 {
+		t.Errorf("vertex 1 has texture coordinates %g, %g, want 0.75, 0.25", u, v)
+	}
+	if !reflect.DeepEqual(m.FaceData, []uint32{0, 1, 2}) {
+		t.Errorf("got faces %v, want [0 1 2]", m.FaceData)
+	}
+
+	missing := strings.Replace(strings.Replace(data, "property float z\n", "", 1), " 0 0 0\n", " 0 0\n", -1)
+	if err := m.Load(strings.NewReader(missing)); err == nil || !strings.Contains(err.Error(), "missing x, y or z") {
+		t.Errorf("loading vertices without z: got error %v, want one for the missing property", err)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// plyType is the type of a PLY property value.
+type plyType uint8
+
+const (
+	plyChar plyType = iota + 1
+	plyUchar
+	plyShort
+	plyUshort
+	plyInt
+	plyUint
+	plyFloat
+	plyDouble
+)
+
+// plyTypes maps the names of PLY property types, in either of their
+// spellings, to the type.
+var plyTypes = map[string]plyType{
+	"char": plyChar, "int8": plyChar,
+	"uchar": plyUchar, "uint8": plyUchar,
+	"short": plyShort, "int16": plyShort,
+	"ushort": plyUshort, "uint16": plyUshort,
+	"int": plyInt, "int32": plyInt,
+	"uint": plyUint, "uint32": plyUint,
+	"float": plyFloat, "float32": plyFloat,
+	"double": plyDouble, "float64": plyDouble,
+}
+
+func (t plyType) String() string {
+	return [...]string{"", "char", "uchar", "short", "ushort", "int", "uint", "float", "double"}[t]
+}
+
+// size returns the size of values of type t in bytes.
+func (t plyType) size() int {
+	return [...]int{0, 1, 1, 2, 2, 4, 4, 4, 8}[t]
+}
+
+// countingReader tracks the position of the data read from r, so errors can
+// say where they were found.
+type countingReader struct {
+	r      *bufio.Reader
+	offset int64  // Offset of the next byte.
+	start  int64  // Offset of the current line or value.
+	line   int    // Number of lines read.
+	long   []byte // Lines longer than the buffer of r.
+}
+
+// readRawLine returns the next line, including its line ending.  The line is
+// only valid until the next read.
+func (c *countingReader) readRawLine() ([]byte, error) {
+	c.start = c.offset
+	line, err := c.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		c.long = append(c.long[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = c.r.ReadSlice('\n')
+			c.long = append(c.long, line...)
+		}
+		line = c.long
+	}
+	c.offset += int64(len(line))
+	if len(line) > 0 {
+		c.line++
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	return line, err
+}
+
+// readLineBytes returns the next line without its line ending.  The line is
+// only valid until the next read.
+func (c *countingReader) readLineBytes() ([]byte, error) {
+	line, err := c.readRawLine()
+	return trimEOL(line), err
+}
+
+// readLine returns the next line without its line ending.
+func (c *countingReader) readLine() (string, error) {
+	line, err := c.readLineBytes()
+	return string(line), err
+}
+
+// valueReader reads the property values of PLY element records.
+type valueReader interface {
+	// next advances to the start of the next element record.
+	next() error
+	// read returns the next value of the current record, decoded as type t.
+	read(t plyType) (float64, error)
+	// done checks that no values of the current record are left.
+	done() error
+	// end checks that no data follows the last record.
+	end() error
+}
+
+func newValueReader(c *countingReader, format string) valueReader {
+	switch format {
+	case "format binary_little_endian 1.0":
+		return &binaryReader{c: c, order: binary.LittleEndian}
+	case "format binary_big_endian 1.0":
+		return &binaryReader{c: c, order: binary.BigEndian}
+	}
+	return &asciiReader{c: c}
+}
+
+// asciiReader reads records stored one per line as whitespace separated
+// values.
+type asciiReader struct {
+	c      *countingReader
+	fields [][]byte
+	pos    int // Index of the next field.
+}
+
+func (a *asciiReader) next() error {
+	for {
+		line, err := a.c.readRawLine()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		a.fields, a.pos = splitFields(a.fields[:0], line), 0
+		if len(a.fields) > 0 {
+			return nil
+		}
+	}
+}
+
+func (a *asciiReader) read(t plyType) (float64, error) {
+	if a.pos == len(a.fields) {
+		return 0, fmt.Errorf("expected %s value, got end of line", t)
+	}
+	f := a.fields[a.pos]
+	a.pos++
+
+	var v float64
+	var ok bool
+	switch t {
+	case plyFloat, plyDouble:
+		v, ok = parseFloat(f)
+	case plyChar, plyShort, plyInt:
+		var i int64
+		i, ok = parseInt(f, uint(8*t.size()), true)
+		v = float64(i)
+	default:
+		var i int64
+		i, ok = parseInt(f, uint(8*t.size()), false)
+		v = float64(i)
+	}
+	if !ok {
+		return 0, fmt.Errorf("invalid %s value %q", t, f)
+	}
+	return v, nil
+}
+
+func (a *asciiReader) done() error {
+	if a.pos < len(a.fields) {
+		return fmt.Errorf("unexpected values at end of line: %q", a.fields[a.pos:])
+	}
+	return nil
+}
+
+func (a *asciiReader) end() error {
+	for {
+		line, err := a.c.readRawLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isBlank(line) {
+			return fmt.Errorf("unexpected data after the last element")
+		}
+	}
+}
+
+// binaryReader reads records stored as packed binary values.
+type binaryReader struct {
+	c     *countingReader
+	order binary.ByteOrder
+}
+
+func (b *binaryReader) next() error {
+	return nil
+}
+
+func (b *binaryReader) read(t plyType) (float64, error) {
+	b.c.start = b.c.offset
+	buf, err := b.c.r.Peek(t.size())
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	var v float64
+	switch t {
+	case plyChar:
+		v = float64(int8(buf[0]))
+	case plyUchar:
+		v = float64(buf[0])
+	case plyShort:
+		v = float64(int16(b.order.Uint16(buf)))
+	case plyUshort:
+		v = float64(b.order.Uint16(buf))
+	case plyInt:
+		v = float64(int32(b.order.Uint32(buf)))
+	case plyUint:
+		v = float64(b.order.Uint32(buf))
+	case plyFloat:
+		v = float64(math.Float32frombits(b.order.Uint32(buf)))
+	default:
+		v = math.Float64frombits(b.order.Uint64(buf))
+	}
+	b.c.r.Discard(len(buf))
+	b.c.offset += int64(len(buf))
+	return v, nil
+}
+
+func (b *binaryReader) done() error {
+	return nil
+}
+
+func (b *binaryReader) end() error {
+	b.c.start = b.c.offset
+	if _, err := b.c.r.Peek(1); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unexpected data after the last element")
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+func encodePLY(m Model, w io.Writer, ascii bool) error {
+	if ascii {
+		return m.Save(w, "ascii")
+	}
+	return m.Save(w, "binary_little_endian")
+}
+
+// Save writes m to w as a PLY file.  Format is the PLY encoding to use:
+// "ascii", "binary_little_endian" or "binary_big_endian".  Normals, texture
+// coordinates and tangents are only written if m has them.  Colors are
+// written as bytes, and other attributes as floats, with a property named
+// <name>_<component> for each component of those with several, which Load
+// reassembles.  Group transforms are applied to the vertices written.
+func (m Model) Save(w io.Writer, format string) error {
+	if m.HasTransforms() {
+		m = m.Clone()
+		m.Bake()
+	}
+	header := fmt.Sprintf("format %s 1.0", format)
+	supported := false
+	for i := range Formats {
+		if header == Formats[i] {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	var props []savedProperty
+	add := func(offset int, color bool, names ...string) {
+		for k, name := range names {
+			props = append(props, savedProperty{name, offset + k, color})
+		}
+	}
+	add(PositionOffset, false, "x", "y", "z")
+	if m.HasNormals {
+		add(NormalOffset, false, "nx", "ny", "nz")
+	}
+	if m.HasTexCoords {
+		add(TexCoordOffset, false, "s", "t")
+	}
+	if m.HasTangents {
+		add(TangentOffset, false, "tx", "ty", "tz", "tw")
+	}
+	for _, a := range m.Attributes {
+		switch {
+		case a.Name == ColorAttribute:
+			add(a.Offset, true, "red", "green", "blue", "alpha")
+		case a.Name == TexCoord1Attribute:
+			add(a.Offset, false, "s1", "t1")
+		case a.Size == 1:
+			add(a.Offset, false, a.Name)
+		default:
+			for k := 0; k < a.Size; k++ {
+				add(a.Offset+k, false, fmt.Sprintf("%s_%d", a.Name, k))
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\n%s\n", header)
+	fmt.Fprintf(bw, "comment Created by shader-tool\n")
+	fmt.Fprintf(bw, "element vertex %d\n", m.VertexCount)
+	for _, p := range props {
+		if p.color {
+			fmt.Fprintf(bw, "property uchar %s\n", p.name)
+		} else {
+			fmt.Fprintf(bw, "property float %s\n", p.name)
+		}
+	}
+	fmt.Fprintf(bw, "element face %d\n", m.FaceCount)
+	fmt.Fprintf(bw, "property list uchar uint vertex_indices\n")
+	fmt.Fprintf(bw, "end_header\n")
+
+	if format == "ascii" {
+		m.writeASCII(bw, props)
+	} else {
+		var order binary.ByteOrder = binary.LittleEndian
+		if format == "binary_big_endian" {
+			order = binary.BigEndian
+		}
+		m.writeBinary(bw, props, order)
+	}
+	return bw.Flush()
+}
+
+// savedProperty is a vertex property written to a PLY file.
+type savedProperty struct {
+	name   string
+	offset int
+	color  bool // Written as a byte from 0 to 255.
+}
+
+// colorByte converts a color component from 0 to 1 to a byte.
+func colorByte(c float32) byte {
+	return byte(math.Max(0, math.Min(255, math.Floor(float64(c)*255+0.5))))
+}
+
+func (m Model) writeASCII(w *bufio.Writer, props []savedProperty) {
+	var buf []byte
+	for i := 0; i < m.VertexCount; i++ {
+		buf = buf[:0]
+		for j, p := range props {
+			if j > 0 {
+				buf = append(buf, ' ')
+			}
+			v := m.VertexData[i*m.Stride+p.offset]
+			if p.color {
+				buf = strconv.AppendInt(buf, int64(colorByte(v)), 10)
+			} else {
+				buf = strconv.AppendFloat(buf, float64(v), 'g', -1, 32)
+			}
+		}
+		buf = append(buf, '\n')
+		w.Write(buf)
+	}
+	for t := 0; t < m.FaceCount; t++ {
+		fmt.Fprintf(w, "3 %d %d %d\n", m.FaceData[3*t], m.FaceData[3*t+1], m.FaceData[3*t+2])
+	}
+}
+
+func (m Model) writeBinary(w *bufio.Writer, props []savedProperty, order binary.ByteOrder) {
+	var buf []byte
+	var word [4]byte
+	for i := 0; i < m.VertexCount; i++ {
+		buf = buf[:0]
+		for _, p := range props {
+			v := m.VertexData[i*m.Stride+p.offset]
+			if p.color {
+				buf = append(buf, colorByte(v))
+			} else {
+				order.PutUint32(word[:], math.Float32bits(v))
+				buf = append(buf, word[:]...)
+			}
+		}
+		w.Write(buf)
+	}
+	face := make([]byte, 13)
+	face[0] = 3
+	for t := 0; t < m.FaceCount; t++ {
+		for k := 0; k < 3; k++ {
+			order.PutUint32(face[1+4*k:], m.FaceData[3*t+k])
+		}
+		w.Write(face)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// savedModel returns a quad with every kind of vertex data Save writes.
+// Colors are multiples of 1/255, so they survive being written as bytes.
+func savedModel() Model {
+	m := New()
+	m.VertexCount = 4
+	m.VertexData = []float32{
+		0, 0, 0, 0, 0, 1, 0, 0, 1, 0, 0, 1,
+		1, 0, 0, 0, 0, 1, 1, 0, 1, 0, 0, 1,
+		1, 1, 0, 0, 0, 1, 1, 1, 1, 0, 0, -1,
+		0, 1, 0, 0, 0, 1, 0, 1, 1, 0, 0, -1,
+	}
+	m.HasNormals, m.HasTexCoords, m.HasTangents = true, true, true
+	m.FaceData = []uint32{0, 1, 2, 0, 2, 3}
+	m.FaceCount = 2
+
+	set := func(name string, size int, values ...float32) {
+		a := m.AddAttribute(name, size)
+		for i := 0; i < m.VertexCount; i++ {
+			copy(m.VertexData[i*m.Stride+a.Offset:], values[i*size:(i+1)*size])
+		}
+	}
+	set(ColorAttribute, 4,
+		1, 0, 0, 1,
+		0, 1, 0, 1,
+		0, 0, 1, 51.0/255,
+		1, 1, 1, 0)
+	set(TexCoord1Attribute, 2, 0.5, 0.5, 0.25, 0.75, 1, 0, 0, 1)
+	set("quality", 1, 0.1, 0.2, 0.3, 0.4)
+	set(JointsAttribute, 4, 0, 1, 0, 0, 1, 0, 0, 0, 2, 3, 1, 0, 3, 0, 0, 0)
+	set(WeightsAttribute, 4, 0.5, 0.5, 0, 0, 1, 0, 0, 0, 0.25, 0.25, 0.5, 0, 1, 0, 0, 0)
+	set(MorphAttribute(MorphPositionPrefix, 0), 3, 0, 0, 1, 0, 0, 2, 0, 0, 3, 0, 0, 4)
+	m.Morphs = []Morph{{}}
+	return m
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	for _, format := range []string{"ascii", "binary_little_endian", "binary_big_endian"} {
+		want := savedModel()
+		var buf bytes.Buffer
+		if err := want.Save(&buf, format); err != nil {
+			t.Fatalf("%s: Save: %v", format, err)
+		}
+		got := New()
+		if err := got.Load(&buf); err != nil {
+			t.Fatalf("%s: Load: %v", format, err)
+		}
+
+		if got.VertexCount != want.VertexCount || got.FaceCount != want.FaceCount {
+			t.Fatalf("%s: got %d vertices and %d faces, want %d and %d", format, got.VertexCount, got.FaceCount, want.VertexCount, want.FaceCount)
+		}
+		if !got.HasNormals || !got.HasTexCoords || !got.HasTangents {
+			t.Errorf("%s: got normals %t, texture coordinates %t, tangents %t, want all", format, got.HasNormals, got.HasTexCoords, got.HasTangents)
+		}
+		for i, v := range want.FaceData {
+			if got.FaceData[i] != v {
+				t.Errorf("%s: face index %d is %d, want %d", format, i, got.FaceData[i], v)
+			}
+		}
+		for _, a := range want.VertexAttributes() {
+			b, ok := got.Attribute(a.Name)
+			if !ok || b.Size != a.Size {
+				t.Errorf("%s: attribute %s is %+v, want size %d", format, a.Name, b, a.Size)
+				continue
+			}
+			for i := 0; i < want.VertexCount; i++ {
+				for k := 0; k < a.Size; k++ {
+					w, g := want.VertexData[i*want.Stride+a.Offset+k], got.VertexData[i*got.Stride+b.Offset+k]
+					if d := w - g; d > 1e-6 || d < -1e-6 {
+						t.Errorf("%s: vertex %d %s[%d] is %g, want %g", format, i, a.Name, k, g, w)
+					}
+				}
+			}
+		}
+		if len(got.Morphs) != len(want.Morphs) {
+			t.Errorf("%s: got %d morph targets, want %d", format, len(got.Morphs), len(want.Morphs))
+		}
+	}
+}
+
+func TestSaveUnsupportedFormat(t *testing.T) {
+	m := savedModel()
+	if err := m.Save(&bytes.Buffer{}, "binary"); err == nil {
+		t.Error("Save with an unknown format succeeded")
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	dir := t.TempDir()
+	want := savedModel()
+	want.Groups = []Group{{Material: -1, Count: 2, Transform: ident4(), Skin: -1, Node: -1}}
+	want.Groups[0].Transform[12] = 5
+	for name, ascii := range map[string]bool{"ascii.ply": true, "binary.ply": false, "model.obj": true, "ascii.stl": true, "binary.stl": false} {
+		filename := filepath.Join(dir, name)
+		if err := want.SaveFile(filename, ascii); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := New()
+		if err := got.LoadFile(filename); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.FaceCount != want.FaceCount {
+			t.Errorf("%s: got %d faces, want %d", name, got.FaceCount, want.FaceCount)
+		}
+		// The group transform is applied to the vertices written.
+		if min, max := got.Bounds(); min != [3]float32{5, 0, 0} || max != [3]float32{6, 1, 0} {
+			t.Errorf("%s: got bounds %v - %v, want [5 0 0] - [6 1 0]", name, min, max)
+		}
+	}
+	if err := want.SaveFile(filepath.Join(dir, "model.txt"), true); err == nil {
+		t.Error("SaveFile to a .txt file succeeded")
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "container/heap"
+
+const (
+	// boundaryWeight scales the planes added along open edges, so that
+	// they are kept in place while the surface is simplified.
+	boundaryWeight = 100
+
+	// lengthWeight scales the squared length of an edge, relative to the
+	// mean triangle area, added to the cost of collapsing it.  Without
+	// it, flat areas collapse onto a single vertex in whatever order the
+	// queue gives, leaving long thin triangles.
+	lengthWeight = 1e-3
+)
+
+// LODs returns a chain of levels of detail, each simplified from the one
+// before it to the given ratio of m's triangles.
+func (m Model) LODs(ratios []float64) []Model {
+	lods := make([]Model, len(ratios))
+	prev := m
+	for i, r := range ratios {
+		lods[i] = prev.Simplify(int(r * float64(m.FaceCount)))
+		prev = lods[i]
+	}
+	return lods
+}
+
+// Simplify returns a copy of m reduced to at most target triangles, or as
+// close to it as possible without folding the surface over.  Edges are
+// collapsed in order of least quadric error, as described by Garland and
+// Heckbert, "Surface Simplification Using Quadric Error Metrics".  Each edge
+// collapses onto one of its ends, so no new vertices are made.
+func (m Model) Simplify(target int) Model {
+	s := m.Clone()
+	if s.FaceCount <= target {
+		return s
+	}
+	ids, n := s.positionIDs()
+	q := newSimplifier(&s, ids, n)
+	for live := s.FaceCount; live > target && q.Len() > 0; {
+		c := heap.Pop(q).(collapse)
+		if !q.current(c) || !q.valid(c.from, c.to) {
+			continue
+		}
+		live -= q.collapse(c.from, c.to)
+	}
+
+	s.dropTriangles(func(t int) bool {
+		return q.gone[t]
+	})
+	s.Compact()
+	return s
+}
+
+// quadric is a symmetric 4x4 matrix, stored as its upper triangle, giving
+// the sum of squared distances of a point to a set of planes.
+type quadric [10]float64
+
+func planeQuadric(n [3]float32, p [3]float32, w float64) quadric {
+	a, b, c := float64(n[0]), float64(n[1]), float64(n[2])
+	d := -(a*float64(p[0]) + b*float64(p[1]) + c*float64(p[2]))
+	return quadric{
+		w * a * a, w * a * b, w * a * c, w * a * d,
+		w * b * b, w * b * c, w * b * d,
+		w * c * c, w * c * d,
+		w * d * d,
+	}
+}
+
+func (q *quadric) add(o quadric) {
+	for i := range q {
+		q[i] += o[i]
+	}
+}
+
+// error returns the error of placing a vertex at p.
+func (q quadric) error(p [3]float32) float64 {
+	x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// collapse moves the position from onto the position to.  The versions of
+// both when the cost was found tell whether it is out of date.
+type collapse struct {
+	from, to       int
+	cost           float64
+	fromVer, toVer int
+}
+
+// simplifier holds the state of a model being simplified.  Vertices split
+// by their other attributes are collapsed together, by position.
+type simplifier struct {
+	m         *Model
+	ids       []int     // Position of each vertex.
+	vertices  [][]int   // Vertices at each position.
+	triangles [][]int   // Triangles around each position.
+	quadrics  []quadric // Error quadric of each position.
+	version   []int     // Changed whenever a position's edges are.
+	length    float64   // Weight of squared edge lengths in costs.
+	dead      []bool    // Collapsed positions.
+	gone      []bool    // Removed triangles.
+	queue     []collapse
+}
+
+func newSimplifier(m *Model, ids []int, n int) *simplifier {
+	q := &simplifier{
+		m:         m,
+		ids:       ids,
+		vertices:  make([][]int, n),
+		triangles: make([][]int, n),
+		quadrics:  make([]quadric, n),
+		version:   make([]int, n),
+		dead:      make([]bool, n),
+		gone:      make([]bool, m.FaceCount),
+	}
+	for i, id := range ids {
+		q.vertices[id] = append(q.vertices[id], i)
+	}
+
+	edges := make(map[[2]int]int)
+	var area float64
+	for t := 0; t < m.FaceCount; t++ {
+		p := q.corners(t)
+		a, b, c := m.vec3(m.FaceData[3*t], PositionOffset), m.vec3(m.FaceData[3*t+1], PositionOffset), m.vec3(m.FaceData[3*t+2], PositionOffset)
+		n := cross3(sub3(b, a), sub3(c, a))
+		a2 := float64(length3(n)) / 2
+		area += a2
+		k := planeQuadric(normalize3(n), a, a2)
+		for i, id := range p {
+			q.triangles[id] = append(q.triangles[id], t)
+			q.quadrics[id].add(k)
+			e := [2]int{id, p[(i+1)%3]}
+			if e[0] > e[1] {
+				e[0], e[1] = e[1], e[0]
+			}
+			edges[e]++
+		}
+	}
+
+	// Hold open edges in place with planes through them, perpendicular to
+	// their triangle.
+	for t := 0; t < m.FaceCount; t++ {
+		p := q.corners(t)
+		a, b, c := m.vec3(m.FaceData[3*t], PositionOffset), m.vec3(m.FaceData[3*t+1], PositionOffset), m.vec3(m.FaceData[3*t+2], PositionOffset)
+		n := cross3(sub3(b, a), sub3(c, a))
+		pos := [3][3]float32{a, b, c}
+		for i := range p {
+			e := [2]int{p[i], p[(i+1)%3]}
+			if e[0] > e[1] {
+				e[0], e[1] = e[1], e[0]
+			}
+			if edges[e] != 1 {
+				continue
+			}
+			d := sub3(pos[(i+1)%3], pos[i])
+			l := float64(length3(d))
+			k := planeQuadric(normalize3(cross3(d, n)), pos[i], boundaryWeight*l*l)
+			q.quadrics[p[i]].add(k)
+			q.quadrics[p[(i+1)%3]].add(k)
+		}
+	}
+
+	q.length = lengthWeight * area / float64(m.FaceCount)
+	for e := range edges {
+		q.queue = append(q.queue, q.cost(e[0], e[1]))
+	}
+	heap.Init(q)
+	return q
+}
+
+// corners returns the positions of the corners of triangle t.
+func (q *simplifier) corners(t int) [3]int {
+	f := q.m.FaceData[3*t : 3*t+3]
+	return [3]int{q.ids[f[0]], q.ids[f[1]], q.ids[f[2]]}
+}
+
+func (q *simplifier) position(id int) [3]float32 {
+	return q.m.vec3(uint32(q.vertices[id][0]), PositionOffset)
+}
+
+// cost returns the cheaper direction of collapsing the edge between a and
+// b.
+func (q *simplifier) cost(a, b int) collapse {
+	k := q.quadrics[a]
+	k.add(q.quadrics[b])
+	pa, pb := q.position(a), q.position(b)
+	l := float64(length3(sub3(pb, pa)))
+	c := collapse{from: a, to: b, cost: k.error(pb) + q.length*l*l}
+	if cost := k.error(pa) + q.length*l*l; cost < c.cost {
+		c = collapse{from: b, to: a, cost: cost}
+	}
+	c.fromVer, c.toVer = q.version[c.from], q.version[c.to]
+	return c
+}
+
+// current reports whether c was found since either position last changed.
+// Only the position collapsed onto changes, the quadrics of its neighbours
+// and so the costs of their other edges are unaffected.
+func (q *simplifier) current(c collapse) bool {
+	return !q.dead[c.from] && !q.dead[c.to] && c.fromVer == q.version[c.from] && c.toVer == q.version[c.to]
+}
+
+// valid reports whether collapsing from onto to keeps the surface
+// manifold and leaves every remaining triangle around from facing the same
+// way.
+func (q *simplifier) valid(from, to int) bool {
+	// The only positions next to both may be those opposite the edge,
+	// otherwise the surface would be pinched together.
+	var opposite []int
+	for _, t := range q.triangles[from] {
+		if q.gone[t] {
+			continue
+		}
+		p := q.corners(t)
+		if p[0] == to || p[1] == to || p[2] == to {
+			opposite = append(opposite, p[0]+p[1]+p[2]-from-to)
+		}
+	}
+	shared := q.neighbours(to)
+	for _, id := range q.neighbours(from) {
+		if contains(shared, id) && !contains(opposite, id) {
+			return false
+		}
+	}
+
+	var faces [][3]int
+	for _, t := range q.triangles[to] {
+		if !q.gone[t] {
+			faces = append(faces, sortedCorners(q.corners(t)))
+		}
+	}
+
+	target := q.position(to)
+	for _, t := range q.triangles[from] {
+		if q.gone[t] {
+			continue
+		}
+		p := q.corners(t)
+		if p[0] == to || p[1] == to || p[2] == to {
+			continue
+		}
+
+		// Closed meshes can not be collapsed past a tetrahedron, which
+		// would leave two triangles back to back.
+		moved := p
+		for i := range moved {
+			if moved[i] == from {
+				moved[i] = to
+			}
+		}
+		moved = sortedCorners(moved)
+		for _, f := range faces {
+			if f == moved {
+				return false
+			}
+		}
+
+		var before, after [3][3]float32
+		for i, id := range p {
+			before[i] = q.position(id)
+			after[i] = before[i]
+			if id == from {
+				after[i] = target
+			}
+		}
+		n0 := cross3(sub3(before[1], before[0]), sub3(before[2], before[0]))
+		n1 := cross3(sub3(after[1], after[0]), sub3(after[2], after[0]))
+		if dot3(n0, n1) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// collapse moves from onto to, returning the number of triangles removed.
+func (q *simplifier) collapse(from, to int) int {
+	f := q.m.FaceData
+
+	// Vertices at from become the vertex at to they shared an edge with,
+	// or failing that the one with the most similar attributes.
+	remap := make(map[uint32]uint32)
+	for _, t := range q.triangles[from] {
+		if q.gone[t] {
+			continue
+		}
+		var a, b = -1, -1
+		for k := 0; k < 3; k++ {
+			switch q.ids[f[3*t+k]] {
+			case from:
+				a = 3*t + k
+			case to:
+				b = 3*t + k
+			}
+		}
+		if a >= 0 && b >= 0 {
+			remap[f[a]] = f[b]
+		}
+	}
+
+	removed := 0
+	for _, t := range q.triangles[from] {
+		if q.gone[t] {
+			continue
+		}
+		p := q.corners(t)
+		if p[0] == to || p[1] == to || p[2] == to {
+			q.gone[t] = true
+			removed++
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			v := f[3*t+k]
+			if q.ids[v] != from {
+				continue
+			}
+			r, ok := remap[v]
+			if !ok {
+				r = q.nearest(v, to)
+				remap[v] = r
+			}
+			f[3*t+k] = r
+		}
+		q.triangles[to] = append(q.triangles[to], t)
+	}
+
+	q.quadrics[to].add(q.quadrics[from])
+	q.dead[from] = true
+	q.version[to]++
+	q.triangles[from] = nil
+	live := q.triangles[to][:0]
+	for _, t := range q.triangles[to] {
+		if !q.gone[t] {
+			live = append(live, t)
+		}
+	}
+	q.triangles[to] = live
+
+	for _, id := range q.neighbours(to) {
+		heap.Push(q, q.cost(to, id))
+	}
+	return removed
+}
+
+// neighbours returns the positions sharing a triangle with id.
+func (q *simplifier) neighbours(id int) []int {
+	var n []int
+	for _, t := range q.triangles[id] {
+		if q.gone[t] {
+			continue
+		}
+		for _, c := range q.corners(t) {
+			if c != id && !contains(n, c) {
+				n = append(n, c)
+			}
+		}
+	}
+	return n
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedCorners(p [3]int) [3]int {
+	if p[0] > p[1] {
+		p[0], p[1] = p[1], p[0]
+	}
+	if p[1] > p[2] {
+		p[1], p[2] = p[2], p[1]
+	}
+	if p[0] > p[1] {
+		p[0], p[1] = p[1], p[0]
+	}
+	return p
+}
+
+// nearest returns the vertex at position to with attributes most like
+// those of vertex v.
+func (q *simplifier) nearest(v uint32, to int) uint32 {
+	best, dist := q.vertices[to][0], float32(-1)
+	for _, c := range q.vertices[to] {
+		var d float32
+		for k := NormalOffset; k < q.m.Stride; k++ {
+			x := q.m.VertexData[int(v)*q.m.Stride+k] - q.m.VertexData[c*q.m.Stride+k]
+			d += x * x
+		}
+		if dist < 0 || d < dist {
+			best, dist = c, d
+		}
+	}
+	return uint32(best)
+}
+
+func (q *simplifier) Len() int           { return len(q.queue) }
+func (q *simplifier) Less(i, j int) bool { return q.queue[i].cost < q.queue[j].cost }
+func (q *simplifier) Swap(i, j int)      { q.queue[i], q.queue[j] = q.queue[j], q.queue[i] }
+func (q *simplifier) Push(x interface{}) { q.queue = append(q.queue, x.(collapse)) }
+
+func (q *simplifier) Pop() interface{} {
+	c := q.queue[len(q.queue)-1]
+	q.queue = q.queue[:len(q.queue)-1]
+	return c
+}
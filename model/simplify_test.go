@@ -0,0 +1,65 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestSimplify(t *testing.T) {
+	// A flat grid loses no detail down to the two triangles of its
+	// outline, whose open edges are kept in place.
+	m := New()
+	if err := m.LoadFile(BuiltinPrefix + "plane?segments=8"); err != nil {
+		t.Fatal(err)
+	}
+	s := m.Simplify(2)
+	if s.FaceCount != 2 {
+		t.Errorf("simplified the plane to %d triangles, want 2", s.FaceCount)
+	}
+	min, max := m.Bounds()
+	if smin, smax := s.Bounds(); smin != min || smax != max {
+		t.Errorf("simplified plane has bounds %v - %v, want %v - %v", smin, smax, min, max)
+	}
+	if m.FaceCount != 128 {
+		t.Errorf("simplifying changed the original to %d triangles", m.FaceCount)
+	}
+}
+
+func TestLODs(t *testing.T) {
+	m := New()
+	if err := m.LoadFile(BuiltinPrefix + "torus"); err != nil {
+		t.Fatal(err)
+	}
+	positions := make(map[[3]float32]bool)
+	for i := uint32(0); i < uint32(m.VertexCount); i++ {
+		positions[m.vec3(i, PositionOffset)] = true
+	}
+
+	lods := m.LODs([]float64{0.5, 0.25, 0.1})
+	prev := m.FaceCount
+	for i, r := range []float64{0.5, 0.25, 0.1} {
+		lod := lods[i]
+		if target := int(r * float64(m.FaceCount)); lod.FaceCount > target || lod.FaceCount >= prev {
+			t.Errorf("level %d has %d triangles, want at most %d and fewer than %d", i, lod.FaceCount, target, prev)
+		}
+		prev = lod.FaceCount
+		// Edges collapse onto their ends, so no new vertices are made.
+		for v := uint32(0); v < uint32(lod.VertexCount); v++ {
+			if p := lod.vec3(v, PositionOffset); !positions[p] {
+				t.Errorf("level %d has vertex %d at %v, not one of the model's", i, v, p)
+				break
+			}
+		}
+	}
+}
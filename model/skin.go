@@ -0,0 +1,143 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "sort"
+
+// MaxInfluences is the number of joints each vertex of a skinned model may
+// be moved by, held in the JointsAttribute and WeightsAttribute.
+const MaxInfluences = 4
+
+// Node is a transform in a model's hierarchy, such as a joint of a skeleton,
+// that animations may move.
+type Node struct {
+	Name        string
+	Parent      int        // Index into Nodes, -1 for a root.  Parents come before their children.
+	Translation [3]float32 // Applied last.
+	Rotation    [4]float32 // Quaternion (x, y, z, w), applied after Scale.
+	Scale       [3]float32
+	Weights     []float32 // Weights of the morph targets set by the node, nil to keep those at rest.
+}
+
+// Skin deforms the vertices of the groups using it by a skeleton of nodes.
+// Each vertex is moved by a weighted sum of the matrices of the joints
+// given by its JointsAttribute, with weights given by its WeightsAttribute.
+type Skin struct {
+	Name        string
+	Joints      []int         // Index into Nodes of each joint.
+	InverseBind [][16]float32 // Matrix moving vertices into the space of each joint in its bind pose.
+	Transform   [16]float32   // Applied to the skinned vertices, as the model is transformed.
+}
+
+// local returns the transform of n relative to its parent.
+func (n Node) local() [16]float32 {
+	return trs(n.Translation, n.Rotation, n.Scale)
+}
+
+// World returns the transform of each node, posed as given, to model space.
+func (m Model) World(pose []Node) [][16]float32 {
+	world := make([][16]float32, len(pose))
+	for i, n := range pose {
+		world[i] = n.local()
+		if n.Parent >= 0 && n.Parent < i {
+			world[i] = mul4(world[n.Parent], world[i])
+		}
+	}
+	return world
+}
+
+// JointMatrices returns, for each joint of skin s, the matrix moving the
+// vertices it influences from their bind pose to the given pose.  With
+// the nodes of m at rest these are usually the identity.
+func (m Model) JointMatrices(s int, pose []Node) [][16]float32 {
+	skin := m.Skins[s]
+	world := m.World(pose)
+	joints := make([][16]float32, len(skin.Joints))
+	for j, n := range skin.Joints {
+		joints[j] = ident4()
+		if n >= 0 && n < len(world) {
+			joints[j] = mul4(skin.Transform, mul4(world[n], skin.InverseBind[j]))
+		}
+	}
+	return joints
+}
+
+// MaxJoints returns the largest number of joints of any skin of m.
+func (m Model) MaxJoints() int {
+	max := 0
+	for _, s := range m.Skins {
+		if len(s.Joints) > max {
+			max = len(s.Joints)
+		}
+	}
+	return max
+}
+
+// transformSkins applies t to the vertices the skins of m have posed, as
+// Transform does.  When the vertices themselves have been moved by t, the
+// inverse bind matrices first undo it, leaving the skeleton where it was.
+func (m *Model) transformSkins(t [16]float32, moved bool) {
+	inv := inverse4(t)
+	for i := range m.Skins {
+		s := &m.Skins[i]
+		s.Transform = mul4(t, s.Transform)
+		for j := 0; moved && j < len(s.InverseBind); j++ {
+			s.InverseBind[j] = mul4(s.InverseBind[j], inv)
+		}
+	}
+}
+
+// influence is a joint moving a vertex and the weight it does so with.
+type influence struct {
+	joint  float32
+	weight float32
+}
+
+// setInfluences sets the joints and weights of vertex v, given by their
+// attribute offsets, to the strongest of influences with their weights
+// normalized.  Influences of the same joint are added together.
+func setInfluences(v []float32, joints, weights int, influences []influence) {
+	merged := influences[:0]
+	for _, in := range influences {
+		found := false
+		for i := range merged {
+			if merged[i].joint == in.joint {
+				merged[i].weight += in.weight
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, in)
+		}
+	}
+	influences = merged
+	sort.SliceStable(influences, func(i, j int) bool {
+		return influences[i].weight > influences[j].weight
+	})
+	if len(influences) > MaxInfluences {
+		influences = influences[:MaxInfluences]
+	}
+	var sum float32
+	for _, in := range influences {
+		sum += in.weight
+	}
+	for k := 0; k < MaxInfluences; k++ {
+		v[joints+k], v[weights+k] = 0, 0
+		if k < len(influences) && sum > 0 {
+			v[joints+k], v[weights+k] = influences[k].joint, influences[k].weight/sum
+		}
+	}
+}
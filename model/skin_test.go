@@ -0,0 +1,83 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+// skinnedModel returns a model with a skin of two joints, the second a
+// child of the first one unit up, and its inverse bind matrices.
+func skinnedModel() Model {
+	m := New()
+	m.Nodes = []Node{
+		{Name: "root", Parent: -1, Rotation: [4]float32{0, 0, 0, 1}, Scale: [3]float32{1, 1, 1}},
+		{Name: "tip", Parent: 0, Translation: [3]float32{0, 1, 0}, Rotation: [4]float32{0, 0, 0, 1}, Scale: [3]float32{1, 1, 1}},
+	}
+	world := m.World(m.Nodes)
+	m.Skins = []Skin{{
+		Joints:      []int{0, 1},
+		InverseBind: [][16]float32{inverse4(world[0]), inverse4(world[1])},
+		Transform:   ident4(),
+	}}
+	return m
+}
+
+// near reports whether the points a and b are within 1e-5 of each other.
+func near(a, b [3]float32) bool {
+	return length3(sub3(a, b)) < 1e-5
+}
+
+func TestJointMatrices(t *testing.T) {
+	m := skinnedModel()
+	for j, joint := range m.JointMatrices(0, m.Nodes) {
+		if p := transformPoint(joint, [3]float32{1, 2, 3}); !near(p, [3]float32{1, 2, 3}) {
+			t.Errorf("joint %d moves [1 2 3] to %v at rest", j, p)
+		}
+	}
+
+	// Turning the root a quarter turn about Z carries the tip with it.
+	pose := m.Pose(-1, 0)
+	pose[0].Rotation = [4]float32{0, 0, 0.70710678, 0.70710678}
+	joints := m.JointMatrices(0, pose)
+	if p := transformPoint(joints[1], [3]float32{0, 2, 0}); !near(p, [3]float32{-2, 0, 0}) {
+		t.Errorf("tip joint moves [0 2 0] to %v, want [-2 0 0]", p)
+	}
+
+	// Transforming the model moves the posed vertices too.
+	m.Transform(trs([3]float32{5, 0, 0}, [4]float32{0, 0, 0, 1}, [3]float32{1, 1, 1}))
+	joints = m.JointMatrices(0, pose)
+	if p := transformPoint(joints[1], [3]float32{5, 2, 0}); !near(p, [3]float32{3, 0, 0}) {
+		t.Errorf("tip joint of the moved model moves [5 2 0] to %v, want [3 0 0]", p)
+	}
+}
+
+func TestSetInfluences(t *testing.T) {
+	v := make([]float32, 8)
+	setInfluences(v, 0, 4, []influence{
+		{joint: 1, weight: 1},
+		{joint: 2, weight: 5.5},
+		{joint: 3, weight: 0.5},
+		{joint: 1, weight: 1},
+		{joint: 4, weight: 1},
+		{joint: 5, weight: 1.5},
+	})
+	// Joint 1's influences are added, joint 3, the weakest of the five
+	// joints, is dropped and the weights of the rest are normalized.
+	want := []float32{2, 1, 5, 4, 0.55, 0.2, 0.15, 0.1}
+	for k := range want {
+		if d := v[k] - want[k]; d > 1e-6 || d < -1e-6 {
+			t.Fatalf("got joints and weights %v, want %v", v, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "sort"
+
+// Stats summarizes a model and counts the problems found in it.  Edges and
+// duplicate triangles are found by vertex position, so vertices split only
+// by their other attributes are treated as one.
+type Stats struct {
+	Format       string     `json:"format"`
+	Vertices     int        `json:"vertices"`
+	Triangles    int        `json:"triangles"`
+	Groups       int        `json:"groups"`
+	Materials    int        `json:"materials"`
+	Skins        int        `json:"skins"`
+	Joints       int        `json:"joints"`
+	Animations   []string   `json:"animations,omitempty"`
+	Morphs       int        `json:"morphs"`
+	HasNormals   bool       `json:"hasNormals"`
+	HasTexCoords bool       `json:"hasTexCoords"`
+	HasTangents  bool       `json:"hasTangents"`
+	Attributes   []string   `json:"attributes,omitempty"`
+	BoundsMin    [3]float32 `json:"boundsMin"`
+	BoundsMax    [3]float32 `json:"boundsMax"`
+	TexCoordMin  [2]float32 `json:"texCoordMin"`
+	TexCoordMax  [2]float32 `json:"texCoordMax"`
+
+	OutOfRangeIndices    int `json:"outOfRangeIndices"`
+	DegenerateTriangles  int `json:"degenerateTriangles"`
+	DuplicateTriangles   int `json:"duplicateTriangles"`
+	UnreferencedVertices int `json:"unreferencedVertices"`
+	BoundaryEdges        int `json:"boundaryEdges"`
+	NonManifoldEdges     int `json:"nonManifoldEdges"`
+	ZeroLengthNormals    int `json:"zeroLengthNormals"`
+}
+
+// Stats returns statistics and diagnostics for m.  Triangles with out of
+// range indices are counted but otherwise ignored.  Models with group
+// transforms are measured with them applied.
+func (m Model) Stats() Stats {
+	if m.HasTransforms() {
+		m = m.Clone()
+		m.Bake()
+	}
+	s := Stats{
+		Format:       m.Format,
+		Vertices:     m.VertexCount,
+		Triangles:    m.FaceCount,
+		Groups:       len(m.Groups),
+		Materials:    len(m.Materials),
+		HasNormals:   m.HasNormals,
+		HasTexCoords: m.HasTexCoords,
+		HasTangents:  m.HasTangents,
+		Skins:        len(m.Skins),
+		Joints:       m.MaxJoints(),
+		Morphs:       len(m.Morphs),
+	}
+	for _, a := range m.Attributes {
+		s.Attributes = append(s.Attributes, a.Name)
+	}
+	for _, a := range m.Animations {
+		s.Animations = append(s.Animations, a.Name)
+	}
+	s.BoundsMin, s.BoundsMax = m.Bounds()
+
+	for i := 0; i < m.VertexCount; i++ {
+		u, v := m.texCoord(uint32(i))
+		if i == 0 || u < s.TexCoordMin[0] {
+			s.TexCoordMin[0] = u
+		}
+		if i == 0 || v < s.TexCoordMin[1] {
+			s.TexCoordMin[1] = v
+		}
+		if i == 0 || u > s.TexCoordMax[0] {
+			s.TexCoordMax[0] = u
+		}
+		if i == 0 || v > s.TexCoordMax[1] {
+			s.TexCoordMax[1] = v
+		}
+		if m.HasNormals && length3(m.vec3(uint32(i), NormalOffset)) < 1e-6 {
+			s.ZeroLengthNormals++
+		}
+	}
+
+	ids, _ := m.positionIDs()
+	referenced := make([]bool, m.VertexCount)
+	triangles := make(map[[3]int]bool)
+	edges := make(map[[2]int]int)
+	for t := 0; t < m.FaceCount && 3*t+2 < len(m.FaceData); t++ {
+		tri := m.FaceData[3*t : 3*t+3]
+		if int(tri[0]) >= m.VertexCount || int(tri[1]) >= m.VertexCount || int(tri[2]) >= m.VertexCount {
+			s.OutOfRangeIndices++
+			continue
+		}
+		for _, i := range tri {
+			referenced[i] = true
+		}
+
+		p := [3]int{ids[tri[0]], ids[tri[1]], ids[tri[2]]}
+		pa, pb, pc := m.vec3(tri[0], PositionOffset), m.vec3(tri[1], PositionOffset), m.vec3(tri[2], PositionOffset)
+		if p[0] == p[1] || p[1] == p[2] || p[2] == p[0] || length3(cross3(sub3(pb, pa), sub3(pc, pa))) == 0 {
+			s.DegenerateTriangles++
+			continue
+		}
+
+		key := p
+		sort.Ints(key[:])
+		if triangles[key] {
+			s.DuplicateTriangles++
+		}
+		triangles[key] = true
+
+		for k := 0; k < 3; k++ {
+			a, b := p[k], p[(k+1)%3]
+			if a > b {
+				a, b = b, a
+			}
+			edges[[2]int{a, b}]++
+		}
+	}
+
+	for _, r := range referenced {
+		if !r {
+			s.UnreferencedVertices++
+		}
+	}
+	for _, n := range edges {
+		switch {
+		case n == 1:
+			s.BoundaryEdges++
+		case n > 2:
+			s.NonManifoldEdges++
+		}
+	}
+	return s
+}
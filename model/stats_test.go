@@ -0,0 +1,38 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	m := savedModel()
+	m.VertexData = append(m.VertexData, m.VertexData[:m.Stride]...)
+	m.VertexCount++
+	// A duplicate of the first triangle, a degenerate one and one with an
+	// out of range index.
+	m.FaceData = append(m.FaceData, 0, 1, 2, 0, 0, 1, 0, 1, 9)
+	m.FaceCount += 3
+
+	s := m.Stats()
+	got := [6]int{s.OutOfRangeIndices, s.DegenerateTriangles, s.DuplicateTriangles, s.UnreferencedVertices, s.BoundaryEdges, s.NonManifoldEdges}
+	// The quad's diagonal is shared by three triangles, the edges of its
+	// second triangle are left open, and the vertex added is unused.
+	if want := [6]int{1, 1, 1, 1, 2, 1}; got != want {
+		t.Errorf("got out of range indices, degenerate and duplicate triangles, unreferenced vertices, boundary and non-manifold edges %v, want %v", got, want)
+	}
+	if s.Format != m.Format || s.Vertices != 5 || s.Triangles != 5 || !s.HasTangents {
+		t.Errorf("got %+v, want the counts of the model", s)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+func init() {
+	RegisterFormat("stl", []string{".stl"}, "solid", decodeSTL)
+	registerDetector("stl", detectBinarySTL)
+	RegisterEncoder("stl", []string{".stl"}, encodeSTL)
+}
+
+// facet is a triangle read from an STL file.
+type facet struct {
+	normal   [3]float32
+	vertices [3][3]float32
+}
+
+// decodeSTL reads an ASCII or binary STL file.  Vertices shared between
+// facets are welded.  When every facet has a normal, vertices are only
+// welded with facets of the same normal, otherwise smooth normals are
+// computed.  STL has no texture coordinates, so a planar projection is
+// generated in their place.
+func decodeSTL(m *Model, r io.Reader, dir string, opts LoadOptions) error {
+	// Progress, if reported, is counted by r as the file is read whole.
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var facets []facet
+	if isBinarySTL(data) {
+		m.Format = "stl binary"
+		facets, err = readBinarySTL(data)
+	} else if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		m.Format = "stl ascii"
+		facets, err = readASCIISTL(data)
+	} else if i, ok := truncatedSTL(data); ok {
+		err = &ParseError{Format: "stl", Offset: int64(84 + 50*i), Element: "facet", Index: i, Err: io.ErrUnexpectedEOF}
+	} else {
+		err = &ParseError{Format: "stl", Offset: 0, Index: -1, Err: fmt.Errorf("invalid stl file")}
+	}
+	if err != nil {
+		return err
+	}
+
+	useNormals := true
+	for _, f := range facets {
+		if f.normal == [3]float32{} {
+			useNormals = false
+			break
+		}
+	}
+
+	welded := make(map[[6]float32]uint32)
+	m.FaceData = make([]uint32, 0, 3*len(facets))
+	for _, f := range facets {
+		for _, p := range f.vertices {
+			var key [6]float32
+			copy(key[:], p[:])
+			if useNormals {
+				copy(key[3:], f.normal[:])
+			}
+			i, ok := welded[key]
+			if !ok {
+				var v [VertexSize]float32
+				copy(v[PositionOffset:], p[:])
+				if useNormals {
+					n := normalize3(f.normal)
+					copy(v[NormalOffset:], n[:])
+				}
+				i = uint32(len(m.VertexData) / m.Stride)
+				m.VertexData = append(m.VertexData, v[:]...)
+				welded[key] = i
+			}
+			m.FaceData = append(m.FaceData, i)
+		}
+	}
+	m.VertexCount = len(m.VertexData) / m.Stride
+	m.FaceCount = len(m.FaceData) / 3
+
+	if useNormals {
+		m.HasNormals = m.FaceCount > 0
+	} else {
+		m.GenerateNormals(SmoothNormals, 0)
+	}
+	m.planarTexCoords()
+	return nil
+}
+
+// isBinarySTL reports whether data's size matches the facet count in its
+// binary header.  ASCII files are identified this way too, as binary files
+// may also start with "solid".
+func isBinarySTL(data []byte) bool {
+	if len(data) < 84 {
+		return false
+	}
+	n := int(binary.LittleEndian.Uint32(data[80:]))
+	return len(data) == 84+50*n
+}
+
+// truncatedSTL reports whether data is a binary STL file ending before all
+// the facets its header counts, and the first facet missing.
+func truncatedSTL(data []byte) (int, bool) {
+	if len(data) < 84 {
+		return 0, false
+	}
+	n := int64(binary.LittleEndian.Uint32(data[80:]))
+	if int64(len(data)) >= 84+50*n {
+		return 0, false
+	}
+	return (len(data) - 84) / 50, true
+}
+
+// detectBinarySTL reports whether r holds a binary STL file, which need not
+// start with "solid".  Files too large to buffer are taken to be binary when
+// the top byte of their facet count is zero, which text never has.
+func detectBinarySTL(r *bufio.Reader) bool {
+	header, err := r.Peek(84)
+	if err != nil {
+		return false
+	}
+	size := 84 + 50*int(binary.LittleEndian.Uint32(header[80:]))
+	if size < r.Size() {
+		data, _ := r.Peek(size + 1)
+		return isBinarySTL(data)
+	}
+	return header[83] == 0
+}
+
+func readBinarySTL(data []byte) ([]facet, error) {
+	n := int(binary.LittleEndian.Uint32(data[80:]))
+	facets := make([]facet, n)
+	for i := range facets {
+		off := 84 + 50*i
+		var v [12]float32
+		for j := range v {
+			v[j] = math.Float32frombits(binary.LittleEndian.Uint32(data[off+4*j:]))
+			if err := finite(float64(v[j])); err != nil {
+				prop := "vertex"
+				if j < 3 {
+					prop = "normal"
+				}
+				return nil, &ParseError{Format: "stl", Offset: int64(off + 4*j), Element: "facet", Index: i, Property: prop, Err: err}
+			}
+		}
+		facets[i].normal = [3]float32{v[0], v[1], v[2]}
+		for j := 0; j < 3; j++ {
+			facets[i].vertices[j] = [3]float32{v[3+3*j], v[4+3*j], v[5+3*j]}
+		}
+	}
+	return facets, nil
+}
+
+// stlToken is a word of an ASCII STL file and where it was found.
+type stlToken struct {
+	text   []byte
+	offset int64
+	line   int
+}
+
+// stlTokenizer splits an ASCII STL file into words as they are needed.
+type stlTokenizer struct {
+	data []byte
+	pos  int
+	line int
+	last stlToken // The word last returned.
+}
+
+// next returns the next word, or false at the end of the data.
+func (t *stlTokenizer) next() (stlToken, bool) {
+	for t.pos < len(t.data) && isSpace(t.data[t.pos]) {
+		if t.data[t.pos] == '\n' {
+			t.line++
+		}
+		t.pos++
+	}
+	if t.pos == len(t.data) {
+		return stlToken{}, false
+	}
+	start := t.pos
+	for t.pos < len(t.data) && !isSpace(t.data[t.pos]) {
+		t.pos++
+	}
+	t.last = stlToken{t.data[start:t.pos], int64(start), t.line}
+	return t.last, true
+}
+
+// peek returns the next word without advancing past it.
+func (t *stlTokenizer) peek() (stlToken, bool) {
+	saved := *t
+	tok, ok := t.next()
+	*t = saved
+	return tok, ok
+}
+
+// vec3 parses the next three words as a vector.
+func (t *stlTokenizer) vec3() ([3]float32, error) {
+	var v [3]float32
+	for i := range v {
+		tok, ok := t.next()
+		if !ok {
+			return v, io.ErrUnexpectedEOF
+		}
+		f, ok := parseFloat(tok.text)
+		if !ok {
+			return v, fmt.Errorf("invalid value %q", tok.text)
+		}
+		v[i] = float32(f)
+		if err := finite(float64(v[i])); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+func readASCIISTL(data []byte) ([]facet, error) {
+	var facets []facet
+	var f facet
+	var loop [][3]float32
+	inFacet := false
+	tokens := stlTokenizer{data: data, line: 1}
+	fail := func(t stlToken, prop string, err error) error {
+		return &ParseError{Format: "stl", Offset: t.offset, Line: t.line, Element: "facet", Index: len(facets), Property: prop, Err: err}
+	}
+	for {
+		t, ok := tokens.next()
+		if !ok {
+			break
+		}
+		switch string(t.text) {
+		case "facet":
+			if inFacet {
+				return nil, fail(t, "", fmt.Errorf("facet is missing endfacet"))
+			}
+			inFacet = true
+			f = facet{}
+			loop = loop[:0]
+			if n, ok := tokens.peek(); ok && string(n.text) == "normal" {
+				tokens.next()
+				v, err := tokens.vec3()
+				if err != nil {
+					return nil, fail(n, "normal", err)
+				}
+				f.normal = v
+			}
+		case "vertex":
+			if !inFacet {
+				return nil, fail(t, "vertex", fmt.Errorf("vertex outside of a facet"))
+			}
+			v, err := tokens.vec3()
+			if err != nil {
+				return nil, fail(t, "vertex", err)
+			}
+			loop = append(loop, v)
+		case "endfacet":
+			if !inFacet {
+				return nil, fail(t, "", fmt.Errorf("endfacet outside of a facet"))
+			}
+			if len(loop) < 3 {
+				return nil, fail(t, "", fmt.Errorf("facet has %d vertices, expected at least 3", len(loop)))
+			}
+			inFacet = false
+			// Fan any polygonal facets into triangles.
+			for j := 1; j < len(loop)-1; j++ {
+				f.vertices = [3][3]float32{loop[0], loop[j], loop[j+1]}
+				facets = append(facets, f)
+			}
+		}
+	}
+	if inFacet {
+		return nil, fail(tokens.last, "", io.ErrUnexpectedEOF)
+	}
+	return facets, nil
+}
+
+// encodeSTL writes the triangles of m as an STL file, using each triangle's
+// own normal.
+func encodeSTL(m Model, w io.Writer, ascii bool) error {
+	bw := bufio.NewWriter(w)
+	if ascii {
+		fmt.Fprintf(bw, "solid model\n")
+	} else {
+		var header [84]byte
+		copy(header[:], "Created by shader-tool")
+		binary.LittleEndian.PutUint32(header[80:], uint32(m.FaceCount))
+		bw.Write(header[:])
+	}
+
+	var buf [50]byte
+	for t := 0; t < m.FaceCount; t++ {
+		var p [3][3]float32
+		for k := range p {
+			p[k] = m.vec3(m.FaceData[3*t+k], PositionOffset)
+		}
+		n := normalize3(cross3(sub3(p[1], p[0]), sub3(p[2], p[0])))
+		if ascii {
+			fmt.Fprintf(bw, "facet normal %g %g %g\n outer loop\n", n[0], n[1], n[2])
+			for _, v := range p {
+				fmt.Fprintf(bw, "  vertex %g %g %g\n", v[0], v[1], v[2])
+			}
+			fmt.Fprintf(bw, " endloop\nendfacet\n")
+			continue
+		}
+		values := [12]float32{n[0], n[1], n[2]}
+		for k, v := range p {
+			copy(values[3+3*k:], v[:])
+		}
+		for j, v := range values {
+			binary.LittleEndian.PutUint32(buf[4*j:], math.Float32bits(v))
+		}
+		bw.Write(buf[:])
+	}
+	if ascii {
+		fmt.Fprintf(bw, "endsolid model\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// stlCube is the corner of a cube, three faces sharing a vertex, each with
+// its own normal.
+const stlCube = `solid corner
+facet normal 0 0 1
+  outer loop
+    vertex 0 0 1
+    vertex 1 0 1
+    vertex 1 1 1
+    vertex 0 1 1
+  endloop
+endfacet
+facet normal 1 0 0
+  outer loop
+    vertex 1 0 0
+    vertex 1 1 0
+    vertex 1 1 1
+  endloop
+endfacet
+facet normal 0 1 0
+  outer loop
+    vertex 0 1 0
+    vertex 0 1 1
+    vertex 1 1 1
+  endloop
+endfacet
+endsolid corner
+`
+
+func TestLoadSTL(t *testing.T) {
+	m := New()
+	if err := m.Load(strings.NewReader(stlCube)); err != nil {
+		t.Fatal(err)
+	}
+	// The quad is fanned into two triangles, and vertices are only welded
+	// within facets of the same normal.
+	if m.Format != "stl ascii" || m.FaceCount != 4 || m.VertexCount != 10 {
+		t.Fatalf("got %s with %d vertices and %d faces, want stl ascii with 10 and 4", m.Format, m.VertexCount, m.FaceCount)
+	}
+	if !m.HasNormals {
+		t.Error("got no normals, want those of the facets")
+	}
+	// Texture coordinates are projected onto the unit square in place of
+	// the ones STL has none of.
+	var sum float32
+	for i := uint32(0); i < uint32(m.VertexCount); i++ {
+		if n := m.vec3(i, NormalOffset); length3(n) < 0.999 {
+			t.Errorf("vertex %d has normal %v, want a unit one", i, n)
+		}
+		u, v := m.texCoord(i)
+		if u < 0 || u > 1 || v < 0 || v > 1 {
+			t.Errorf("vertex %d has texture coordinates %g, %g, want them within [0, 1]", i, u, v)
+		}
+		sum += u + v
+	}
+	if sum == 0 {
+		t.Error("got no texture coordinates")
+	}
+
+	// Without normals, vertices are welded by position alone and given
+	// smooth normals.
+	noNormals := strings.NewReplacer("normal 0 0 1", "normal 0 0 0", "normal 1 0 0", "normal 0 0 0", "normal 0 1 0", "normal 0 0 0").Replace(stlCube)
+	if err := m.Load(strings.NewReader(noNormals)); err != nil {
+		t.Fatal(err)
+	}
+	if m.VertexCount != 7 || !m.HasNormals {
+		t.Errorf("got %d vertices and normals %t, want 7 with normals", m.VertexCount, m.HasNormals)
+	}
+}
+
+func TestLoadBinarySTL(t *testing.T) {
+	// Binary files may start with "solid" too.
+	var buf bytes.Buffer
+	header := make([]byte, 80)
+	copy(header, "solid but binary")
+	buf.Write(header)
+	binary.Write(&buf, binary.LittleEndian, uint32(2))
+	for _, f := range [][12]float32{
+		{0, 0, 1, 0, 0, 0, 1, 0, 0, 1, 1, 0},
+		{0, 0, 1, 0, 0, 0, 1, 1, 0, 0, 1, 0},
+	} {
+		for _, v := range f {
+			binary.Write(&buf, binary.LittleEndian, math.Float32bits(v))
+		}
+		buf.Write([]byte{0, 0})
+	}
+
+	m := New()
+	if err := m.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if m.Format != "stl binary" || m.FaceCount != 2 || m.VertexCount != 4 {
+		t.Errorf("got %s with %d vertices and %d faces, want stl binary with 4 and 2", m.Format, m.VertexCount, m.FaceCount)
+	}
+}
@@ -0,0 +1,561 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// SubdivisionScheme selects how Subdivide refines a model.
+type SubdivisionScheme int
+
+const (
+	// LoopSubdivision splits each triangle into four, as described by
+	// Loop, "Smooth Subdivision Surfaces Based on Triangles".
+	LoopSubdivision SubdivisionScheme = iota
+	// CatmullClarkSubdivision splits each face into quads, as described by
+	// Catmull and Clark, "Recursively Generated B-spline Surfaces on
+	// Arbitrary Topological Meshes".  The polygons the model's triangles
+	// were split from, as kept in Polygons, are subdivided in their place.
+	CatmullClarkSubdivision
+)
+
+var subdivisionSchemeNames = [...]string{"loop", "catmull-clark"}
+
+func (s SubdivisionScheme) String() string {
+	if s < 0 || int(s) >= len(subdivisionSchemeNames) {
+		return fmt.Sprintf("SubdivisionScheme(%d)", int(s))
+	}
+	return subdivisionSchemeNames[s]
+}
+
+// ParseSubdivisionScheme returns the SubdivisionScheme with the given name.
+func ParseSubdivisionScheme(s string) (SubdivisionScheme, error) {
+	for i, name := range subdivisionSchemeNames {
+		if s == name {
+			return SubdivisionScheme(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown subdivision scheme: %s", s)
+}
+
+// Subdivide returns a copy of m with its faces subdivided levels times,
+// smoothing its surface.  Vertices at the same position are moved together
+// even if other attributes differ.  Other attributes are smoothed with the
+// seams between them kept, so texture coordinates stay continuous within
+// each chart.  Open edges, and edges whose faces meet at more than the crease
+// angle in degrees, are kept sharp; a crease angle of 180 smooths every
+// other edge.  Normals and tangents are generated again if m has them, and
+// group transforms are applied first, as instances of a part must be
+// subdivided apart.
+func (m Model) Subdivide(scheme SubdivisionScheme, levels int, creaseAngle float64) Model {
+	s := m.Clone()
+	if levels <= 0 || s.FaceCount == 0 {
+		return s
+	}
+	s.Bake()
+	cc := scheme == CatmullClarkSubdivision
+	d := newSubdivider(&s, cc, creaseAngle)
+	for i := 0; i < levels; i++ {
+		d.subdivide(cc)
+	}
+	d.finish(s.FaceCount)
+
+	if s.HasNormals {
+		if creaseAngle < 180 {
+			s.GenerateNormals(CreaseNormals, creaseAngle)
+		} else {
+			s.GenerateNormals(AngleNormals, 0)
+		}
+	}
+	if s.HasTangents {
+		s.GenerateTangents()
+	}
+	return s
+}
+
+// subdivider holds a model's faces as they are subdivided.  Positions are
+// smoothed over points, the distinct positions of the vertices, so faces
+// with different texture coordinates or normals stay joined.
+type subdivider struct {
+	m      *Model
+	faces  []uint32 // Vertex indices of each face, concatenated.
+	starts []int    // Start of each face in faces, and the end of the last.
+	origin []int    // Triangle of the model each face was made from.
+
+	points []uint32           // Point of each vertex.
+	pos    []float32          // Position of each point.
+	sharp  map[[2]uint32]bool // Creased edges between points, lowest first.
+}
+
+func newSubdivider(m *Model, cc bool, creaseAngle float64) *subdivider {
+	d := &subdivider{m: m, sharp: make(map[[2]uint32]bool)}
+	ids, n := m.positionIDs()
+	d.points = make([]uint32, len(ids))
+	d.pos = make([]float32, 3*n)
+	for v, id := range ids {
+		d.points[v] = uint32(id)
+		p := m.vec3(uint32(v), PositionOffset)
+		copy(d.pos[3*id:], p[:])
+	}
+
+	d.starts = []int{0}
+	for t := 0; t < m.FaceCount; t++ {
+		d.faces = append(d.faces, m.FaceData[3*t:3*t+3]...)
+		d.starts = append(d.starts, len(d.faces))
+		d.origin = append(d.origin, t)
+	}
+	if cc {
+		d.joinPolygons()
+	}
+
+	if creaseAngle < 180 {
+		cosCrease := float32(math.Cos(creaseAngle * math.Pi / 180))
+		t := d.topology(d.point, n, false)
+		for e, ends := range t.ends {
+			if t.count[e] != 2 {
+				continue
+			}
+			a, b := d.normal(t.faces[e][0]), d.normal(t.faces[e][1])
+			if dot3(a, b) < cosCrease {
+				d.sharp[ends] = true
+			}
+		}
+	}
+	return d
+}
+
+func (d *subdivider) vertex(v uint32) uint32 { return v }
+func (d *subdivider) point(v uint32) uint32  { return d.points[v] }
+
+// face returns the vertex indices of face f.
+func (d *subdivider) face(f int) []uint32 {
+	return d.faces[d.starts[f]:d.starts[f+1]]
+}
+
+// normal returns the unit normal of face f.
+func (d *subdivider) normal(f int) [3]float32 {
+	var n [3]float32
+	corners := d.face(f)
+	for i, v := range corners {
+		p, q := d.position(d.points[v]), d.position(d.points[corners[(i+1)%len(corners)]])
+		c := cross3(p, q)
+		for k := range n {
+			n[k] += c[k]
+		}
+	}
+	return normalize3(n)
+}
+
+func (d *subdivider) position(p uint32) [3]float32 {
+	return [3]float32{d.pos[3*p], d.pos[3*p+1], d.pos[3*p+2]}
+}
+
+// joinPolygons joins the triangles of each polygon in Polygons back into
+// the polygon.  Those whose outline cannot be traced, such as polygons
+// touching themselves, are left as triangles.
+func (d *subdivider) joinPolygons() {
+	m := d.m
+	if len(m.Polygons) == 0 || !m.polygonsMatch() {
+		return
+	}
+	faces := make([]uint32, 0, len(d.faces))
+	d.starts, d.origin = d.starts[:1], d.origin[:0]
+	t := 0
+	for _, n := range m.Polygons {
+		tris := m.FaceData[3*t : 3*(t+n-2)]
+		if corners, ok := d.outline(tris, n); ok {
+			faces = append(faces, corners...)
+			d.starts = append(d.starts, len(faces))
+			d.origin = append(d.origin, t)
+		} else {
+			for i := 0; i < n-2; i++ {
+				faces = append(faces, tris[3*i:3*i+3]...)
+				d.starts = append(d.starts, len(faces))
+				d.origin = append(d.origin, t+i)
+			}
+		}
+		t += n - 2
+	}
+	d.faces = faces
+}
+
+// outline returns the n corners of the polygon covered by tris, traced
+// along the sides between points that no other of the triangles shares, or
+// false if they do not form a single loop.
+func (d *subdivider) outline(tris []uint32, n int) ([]uint32, bool) {
+	if n == 3 {
+		return tris, true
+	}
+	// Corners are indices into tris, followed by the next corner of
+	// their triangle.
+	following := func(c int) int { return c - c%3 + (c+1)%3 }
+	point := func(c int) uint32 { return d.points[tris[c]] }
+	shared := func(c int) bool {
+		for o := range tris {
+			if point(o) == point(following(c)) && point(following(o)) == point(c) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// next holds the outline corner at each point of the outline.
+	next := make(map[uint32]int, n)
+	for c := range tris {
+		if shared(c) {
+			continue
+		}
+		if _, ok := next[point(c)]; ok {
+			return nil, false
+		}
+		next[point(c)] = c
+	}
+	if len(next) != n {
+		return nil, false
+	}
+
+	corners := make([]uint32, 0, n)
+	c, ok := next[point(0)]
+	for ok && len(corners) < n {
+		corners = append(corners, tris[c])
+		c, ok = next[point(following(c))]
+		if ok && point(c) == point(0) && len(corners) < n {
+			return nil, false
+		}
+	}
+	return corners, ok && point(c) == point(0)
+}
+
+// subdivTopology holds the edges between the nodes, vertices or points, of
+// the faces being subdivided.
+type subdivTopology struct {
+	ends      [][2]uint32 // Nodes at the ends of each edge, lowest first.
+	index     map[[2]uint32]int
+	count     []int       // Number of faces on each edge.
+	faces     [][2]int    // First two faces on each edge.
+	sides     [][2]int    // Side of each of those faces the edge is on.
+	opposite  [][2]uint32 // Node opposite each edge in those faces.
+	sideEdges []int       // Edge on each side of each face, as in faces.
+	nodeEdges [][]int     // Edges at each node.
+	nodeFaces [][]int     // Faces at each node, when needed.
+
+	node func(v uint32) uint32 // Node of each vertex.
+}
+
+// topology returns the edges of the faces of d, with node giving the node
+// of each vertex.
+func (d *subdivider) topology(node func(v uint32) uint32, nodes int, withFaces bool) *subdivTopology {
+	t := &subdivTopology{
+		index:     make(map[[2]uint32]int),
+		sideEdges: make([]int, len(d.faces)),
+		nodeEdges: make([][]int, nodes),
+		node:      node,
+	}
+	if withFaces {
+		t.nodeFaces = make([][]int, nodes)
+	}
+	for f := 0; f+1 < len(d.starts); f++ {
+		start, end := d.starts[f], d.starts[f+1]
+		for c := start; c < end; c++ {
+			next := c + 1
+			if next == end {
+				next = start
+			}
+			a, b := node(d.faces[c]), node(d.faces[next])
+			key := edgeKey(a, b)
+			e, ok := t.index[key]
+			if !ok {
+				e = len(t.ends)
+				t.index[key] = e
+				t.ends = append(t.ends, key)
+				t.count = append(t.count, 0)
+				t.faces = append(t.faces, [2]int{-1, -1})
+				t.sides = append(t.sides, [2]int{})
+				t.opposite = append(t.opposite, [2]uint32{})
+				t.nodeEdges[a] = append(t.nodeEdges[a], e)
+				if b != a {
+					t.nodeEdges[b] = append(t.nodeEdges[b], e)
+				}
+			}
+			if k := t.count[e]; k < 2 {
+				t.faces[e][k], t.sides[e][k] = f, c-start
+				if end-start == 3 {
+					t.opposite[e][k] = node(d.faces[start+(c-start+2)%3])
+				}
+			}
+			t.count[e]++
+			t.sideEdges[c] = e
+			if withFaces {
+				t.nodeFaces[a] = append(t.nodeFaces[a], f)
+			}
+		}
+	}
+	return t
+}
+
+func edgeKey(a, b uint32) [2]uint32 {
+	if b < a {
+		return [2]uint32{b, a}
+	}
+	return [2]uint32{a, b}
+}
+
+// refine returns the values, dim floats for each node of t, of the nodes of
+// the next level: the old nodes, moved, followed by a node on each edge and,
+// for Catmull-Clark, one in each face.  Edges marked sharp are creased.
+func (t *subdivTopology) refine(d *subdivider, values []float32, dim int, sharp []bool, cc bool) []float32 {
+	nodes, edges, faces := len(values)/dim, len(t.ends), len(d.starts)-1
+	n := nodes + edges
+	if cc {
+		n += faces
+	}
+	out := make([]float32, n*dim)
+	in := func(i uint32) []float32 { return values[int(i)*dim : int(i+1)*dim] }
+	at := func(i int) []float32 { return out[i*dim : (i+1)*dim] }
+	add := func(dst, src []float32, w float32) {
+		for k := range dst {
+			dst[k] += w * src[k]
+		}
+	}
+	facePoint := func(f int) []float32 { return at(nodes + edges + f) }
+
+	if cc {
+		for f := 0; f < faces; f++ {
+			corners := d.face(f)
+			for _, v := range corners {
+				add(facePoint(f), in(t.node(v)), 1/float32(len(corners)))
+			}
+		}
+	}
+
+	for e, ends := range t.ends {
+		p := at(nodes + e)
+		a, b := in(ends[0]), in(ends[1])
+		switch {
+		case sharp[e]:
+			add(p, a, 0.5)
+			add(p, b, 0.5)
+		case cc:
+			add(p, a, 0.25)
+			add(p, b, 0.25)
+			add(p, facePoint(t.faces[e][0]), 0.25)
+			add(p, facePoint(t.faces[e][1]), 0.25)
+		default:
+			add(p, a, 3.0/8)
+			add(p, b, 3.0/8)
+			add(p, in(t.opposite[e][0]), 1.0/8)
+			add(p, in(t.opposite[e][1]), 1.0/8)
+		}
+	}
+
+	for v := 0; v < nodes; v++ {
+		p, self := at(v), in(uint32(v))
+		around := t.nodeEdges[v]
+		creases, crease := 0, [2]uint32{}
+		for _, e := range around {
+			if sharp[e] {
+				if creases < 2 {
+					crease[creases] = t.other(e, uint32(v))
+				}
+				creases++
+			}
+		}
+		k := float32(len(around))
+		switch {
+		case len(around) == 0 || creases > 2:
+			copy(p, self)
+		case creases == 2:
+			add(p, self, 6.0/8)
+			add(p, in(crease[0]), 1.0/8)
+			add(p, in(crease[1]), 1.0/8)
+		case cc:
+			// (Q + 2R + (n-3)S) / n, with R the mean of the edge
+			// midpoints.
+			for _, f := range t.nodeFaces[v] {
+				add(p, facePoint(f), 1/(k*float32(len(t.nodeFaces[v]))))
+			}
+			for _, e := range around {
+				add(p, in(t.other(e, uint32(v))), 1/(k*k))
+			}
+			add(p, self, (k-2)/k)
+		default:
+			c := 3.0/8 + math.Cos(2*math.Pi/float64(k))/4
+			beta := float32((5.0/8 - c*c) / float64(k))
+			for _, e := range around {
+				add(p, in(t.other(e, uint32(v))), beta)
+			}
+			add(p, self, 1-k*beta)
+		}
+	}
+	return out
+}
+
+// other returns the node at the other end of edge e from v.
+func (t *subdivTopology) other(e int, v uint32) uint32 {
+	if t.ends[e][0] == v {
+		return t.ends[e][1]
+	}
+	return t.ends[e][0]
+}
+
+// blendInfluences sets the joints and weights of the vertices refine gave
+// data, which it would otherwise mix the joint indices of.  Old vertices
+// keep theirs, and new ones are moved by the joints of the vertices of the
+// edge or face they were added to.
+func (d *subdivider) blendInfluences(data []float32, t *subdivTopology, cc bool) {
+	m := d.m
+	joints, ok := m.Attribute(JointsAttribute)
+	weights, hasWeights := m.Attribute(WeightsAttribute)
+	if !ok || !hasWeights {
+		return
+	}
+	vertices := len(m.VertexData) / m.Stride
+	var influences []influence
+	set := func(i int, from []uint32) {
+		influences = influences[:0]
+		for _, v := range from {
+			src := m.VertexData[int(v)*m.Stride : int(v+1)*m.Stride]
+			for k := 0; k < MaxInfluences; k++ {
+				if w := src[weights.Offset+k]; w > 0 {
+					influences = append(influences, influence{src[joints.Offset+k], w / float32(len(from))})
+				}
+			}
+		}
+		setInfluences(data[i*m.Stride:(i+1)*m.Stride], joints.Offset, weights.Offset, influences)
+	}
+	for v := 0; v < vertices; v++ {
+		set(v, []uint32{uint32(v)})
+	}
+	for e, ends := range t.ends {
+		set(vertices+e, ends[:])
+	}
+	if cc {
+		for f := 0; f+1 < len(d.starts); f++ {
+			set(vertices+len(t.ends)+f, d.face(f))
+		}
+	}
+}
+
+// subdivide refines the faces of d once.
+func (d *subdivider) subdivide(cc bool) {
+	m := d.m
+	vertices, points := len(d.points), len(d.pos)/3
+	tv := d.topology(d.vertex, vertices, cc)
+	tp := d.topology(d.point, points, cc)
+
+	// Seams between vertices are creased for their attributes, as are the
+	// creases between points.
+	pointSharp := make([]bool, len(tp.ends))
+	for e, ends := range tp.ends {
+		pointSharp[e] = tp.count[e] != 2 || d.sharp[ends]
+	}
+	pointEdge := make([]int, len(tv.ends))
+	vertexSharp := make([]bool, len(tv.ends))
+	for e, ends := range tv.ends {
+		pointEdge[e] = tp.index[edgeKey(d.points[ends[0]], d.points[ends[1]])]
+		vertexSharp[e] = tv.count[e] != 2 || pointSharp[pointEdge[e]]
+	}
+	data := tv.refine(d, m.VertexData, m.Stride, vertexSharp, cc)
+	d.blendInfluences(data, tv, cc)
+	pos := tp.refine(d, d.pos, 3, pointSharp, cc)
+
+	newPoints := append([]uint32(nil), d.points...)
+	for e := range tv.ends {
+		newPoints = append(newPoints, uint32(points+pointEdge[e]))
+	}
+	if cc {
+		for f := 0; f+1 < len(d.starts); f++ {
+			newPoints = append(newPoints, uint32(points+len(tp.ends)+f))
+		}
+	}
+	for v, p := range newPoints {
+		copy(data[v*m.Stride+PositionOffset:], pos[3*p:3*p+3])
+	}
+
+	sharp := make(map[[2]uint32]bool)
+	for e, ends := range tp.ends {
+		if d.sharp[ends] {
+			mid := uint32(points + e)
+			sharp[edgeKey(ends[0], mid)] = true
+			sharp[edgeKey(ends[1], mid)] = true
+		}
+	}
+
+	var faces []uint32
+	starts := []int{0}
+	var origin []int
+	for f := 0; f+1 < len(d.starts); f++ {
+		start, corners := d.starts[f], d.face(f)
+		edge := func(i int) uint32 {
+			return uint32(vertices + tv.sideEdges[start+(i+len(corners))%len(corners)])
+		}
+		if cc {
+			center := uint32(vertices + len(tv.ends) + f)
+			for i, v := range corners {
+				faces = append(faces, v, edge(i), center, edge(i-1))
+				starts = append(starts, len(faces))
+				origin = append(origin, d.origin[f])
+			}
+			continue
+		}
+		for i, v := range corners {
+			faces = append(faces, v, edge(i), edge(i-1))
+			starts = append(starts, len(faces))
+			origin = append(origin, d.origin[f])
+		}
+		faces = append(faces, edge(0), edge(1), edge(2))
+		starts = append(starts, len(faces))
+		origin = append(origin, d.origin[f])
+	}
+
+	m.VertexData = data
+	d.faces, d.starts, d.origin = faces, starts, origin
+	d.points, d.pos, d.sharp = newPoints, pos, sharp
+}
+
+// finish triangulates the faces of d into the model, whose groups covered
+// the given number of triangles before subdivision.
+func (d *subdivider) finish(triangles int) {
+	m := d.m
+	m.VertexCount = len(m.VertexData) / m.Stride
+	m.FaceData = make([]uint32, 0, 3*(len(d.faces)-len(d.starts)))
+	first := make([]int, triangles+1)
+	polygons := make([]int, 0, len(d.starts)-1)
+	for f := 0; f+1 < len(d.starts); f++ {
+		before := len(m.FaceData)
+		m.FaceData = m.triangulate(m.FaceData, d.face(f))
+		first[d.origin[f]+1] += (len(m.FaceData) - before) / 3
+		polygons = append(polygons, len(d.face(f)))
+	}
+	m.FaceCount = len(m.FaceData) / 3
+	m.Polygons = polygonCounts(polygons)
+	// Vertices of joined triangles that did not become corners of their
+	// polygon are left unused.
+	m.Compact()
+
+	// Faces are kept in the order of the triangles they came from, so each
+	// group still covers a single range.
+	for t := 1; t <= triangles; t++ {
+		first[t] += first[t-1]
+	}
+	for i := range m.Groups {
+		g := &m.Groups[i]
+		end := first[g.First+g.Count]
+		g.First = first[g.First]
+		g.Count = end - g.First
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCatmullClarkPolygons(t *testing.T) {
+	tests := []struct {
+		name, data string
+		polygons   []int
+		triangles  int // After one level of subdivision.
+	}{
+		// A quad bent along its diagonal, and a pentagon.
+		{"bent.ply", `ply
+format ascii 1.0
+element vertex 9
+property float x
+property float y
+property float z
+element face 2
+property list uchar int vertex_indices
+end_header
+0 0 0
+1 0 0
+1 1 0.5
+0 1 0
+3 0 0
+4 0 0
+4.5 1 0
+3.5 2 0
+2.5 1 0
+4 0 1 2 3
+5 4 5 6 7 8
+`, []int{4, 5}, 2 * (4 + 5)},
+		{"mixed.obj", "v 0 0 0\nv 1 0 0\nv 1 1 0.5\nv 0 1 0\nv 2 0 0\nf 1 2 3 4\nf 2 5 3\n", []int{4, 3}, 2 * (4 + 3)},
+		{"triangles.obj", "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1 2 3\nf 1 3 4\n", nil, 2 * (3 + 3)},
+	}
+	for _, test := range tests {
+		m := New()
+		if err := m.Load(strings.NewReader(test.data)); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(m.Polygons, test.polygons) {
+			t.Errorf("%s: got polygons %v, want %v", test.name, m.Polygons, test.polygons)
+		}
+		s := m.Subdivide(CatmullClarkSubdivision, 1, 180)
+		if s.FaceCount != test.triangles {
+			t.Errorf("%s: subdivided into %d triangles, want %d", test.name, s.FaceCount, test.triangles)
+		}
+	}
+}
+
+func TestCatmullClarkBuiltin(t *testing.T) {
+	m := New()
+	if err := m.LoadFile(BuiltinPrefix + "cube"); err != nil {
+		t.Fatal(err)
+	}
+	s := m.Subdivide(CatmullClarkSubdivision, 2, 180)
+	if want := 2 * 6 * 16; s.FaceCount != want {
+		t.Errorf("subdivided into %d triangles, want %d", s.FaceCount, want)
+	}
+	if len(s.Polygons) != s.FaceCount/2 {
+		t.Errorf("got %d polygons, want %d quads", len(s.Polygons), s.FaceCount/2)
+	}
+}
+
+func TestDropTrianglesSplitsPolygons(t *testing.T) {
+	m := New()
+	m.FaceCount = 6
+	m.FaceData = make([]uint32, 3*m.FaceCount)
+	m.Polygons = []int{4, 3, 5}
+	m.dropTriangles(func(t int) bool { return t == 4 })
+	if want := []int{4, 3, 3, 3}; !reflect.DeepEqual(m.Polygons, want) {
+		t.Errorf("got polygons %v, want %v", m.Polygons, want)
+	}
+	m.dropTriangles(func(t int) bool { return t < 2 })
+	if m.Polygons != nil {
+		t.Errorf("got polygons %v for triangles alone", m.Polygons)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// GenerateTangents computes a tangent for each vertex pointing in the
+// direction of increasing U, orthogonal to the vertex normal.  The fourth
+// tangent component is the handedness, such that the bitangent, pointing in
+// the direction of increasing V, is cross(normal, tangent) * w.
+//
+// As with MikkTSpace, triangle contributions are weighted by their angle at
+// the vertex, and vertices shared by triangles with mirrored texture
+// coordinates are split so each side keeps its own handedness.
+func (m *Model) GenerateTangents() {
+	type key struct {
+		vertex uint32
+		w      float32
+	}
+	type basis struct {
+		s, t [3]float32
+	}
+	sums := make(map[key]*basis)
+	corners := make([]key, len(m.FaceData))
+
+	for t := 0; t < m.FaceCount; t++ {
+		i0, i1, i2 := m.FaceData[3*t], m.FaceData[3*t+1], m.FaceData[3*t+2]
+		p0, p1, p2 := m.vec3(i0, PositionOffset), m.vec3(i1, PositionOffset), m.vec3(i2, PositionOffset)
+		u0, v0 := m.texCoord(i0)
+		u1, v1 := m.texCoord(i1)
+		u2, v2 := m.texCoord(i2)
+
+		e1, e2 := sub3(p1, p0), sub3(p2, p0)
+		du1, dv1, du2, dv2 := u1-u0, v1-v0, u2-u0, v2-v0
+		var sdir, tdir [3]float32
+		if r := du1*dv2 - du2*dv1; r != 0 {
+			for k := 0; k < 3; k++ {
+				sdir[k] = (e1[k]*dv2 - e2[k]*dv1) / r
+				tdir[k] = (e2[k]*du1 - e1[k]*du2) / r
+			}
+		}
+
+		// Mirrored texture coordinates flip the bitangent.
+		w := float32(1)
+		if dot3(cross3(sdir, tdir), cross3(e1, e2)) < 0 {
+			w = -1
+		}
+		sdir, tdir = normalize3(sdir), normalize3(tdir)
+
+		for k := 0; k < 3; k++ {
+			c := key{m.FaceData[3*t+k], w}
+			corners[3*t+k] = c
+			b, ok := sums[c]
+			if !ok {
+				b = &basis{}
+				sums[c] = b
+			}
+			a := m.cornerAngle(t, k)
+			for j := 0; j < 3; j++ {
+				b.s[j] += a * sdir[j]
+				b.t[j] += a * tdir[j]
+			}
+		}
+	}
+
+	// Assign each vertex's first handedness to the vertex itself and any
+	// other to a copy.
+	index := make(map[key]uint32, len(sums))
+	used := make([]bool, m.VertexCount)
+	for c, k := range corners {
+		i, ok := index[k]
+		if !ok {
+			i = k.vertex
+			if used[i] {
+				i = uint32(m.VertexCount)
+				m.VertexData = append(m.VertexData, m.VertexData[int(k.vertex)*m.Stride:int(k.vertex+1)*m.Stride]...)
+				m.VertexCount++
+			}
+			used[k.vertex] = true
+			index[k] = i
+			m.setTangent(i, sums[k].s, k.w)
+		}
+		m.FaceData[c] = i
+	}
+	for i := range used {
+		if !used[i] {
+			m.setTangent(uint32(i), [3]float32{}, 1)
+		}
+	}
+	m.HasTangents = true
+}
+
+// setTangent sets the tangent of vertex i to s made orthogonal to the
+// vertex normal, with handedness w.
+func (m *Model) setTangent(i uint32, s [3]float32, w float32) {
+	n := m.vec3(i, NormalOffset)
+	d := dot3(n, s)
+	t := normalize3([3]float32{s[0] - n[0]*d, s[1] - n[1]*d, s[2] - n[2]*d})
+	if t == [3]float32{} {
+		t = perpendicular(n)
+	}
+	m.setVec3(i, TangentOffset, t)
+	m.VertexData[int(i)*m.Stride+TangentOffset+3] = w
+}
+
+func (m *Model) texCoord(i uint32) (float32, float32) {
+	o := int(i)*m.Stride + TexCoordOffset
+	return m.VertexData[o], m.VertexData[o+1]
+}
+
+// perpendicular returns a unit vector orthogonal to n.
+func perpendicular(n [3]float32) [3]float32 {
+	axis := [3]float32{1, 0, 0}
+	if n[0]*n[0] > n[1]*n[1] {
+		axis = [3]float32{0, 1, 0}
+	}
+	if t := normalize3(cross3(n, axis)); t != [3]float32{} {
+		return t
+	}
+	return [3]float32{1, 0, 0}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateTangents(t *testing.T) {
+	// Two quads facing +Z, the right one with its texture mirrored, so
+	// the vertices of the edge they share have either handedness.
+	const mirrored = `v 0 0 0
+v 1 0 0
+v 2 0 0
+v 0 1 0
+v 1 1 0
+v 2 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+f 1/1/1 2/2/1 5/3/1 4/4/1
+f 2/2/1 3/1/1 6/4/1 5/3/1
+`
+	m := New()
+	if err := m.Load(strings.NewReader(mirrored)); err != nil {
+		t.Fatal(err)
+	}
+	if m.VertexCount != 6 {
+		t.Fatalf("got %d vertices, want 6", m.VertexCount)
+	}
+	m.GenerateTangents()
+	if !m.HasTangents {
+		t.Error("HasTangents is false after generating tangents")
+	}
+	if m.VertexCount != 8 {
+		t.Errorf("got %d vertices, want the 2 on the mirrored edge split", m.VertexCount)
+	}
+
+	for f := 0; f < m.FaceCount; f++ {
+		want := [4]float32{1, 0, 0, 1}
+		if f >= 2 {
+			want = [4]float32{-1, 0, 0, -1}
+		}
+		for _, i := range m.FaceData[3*f : 3*f+3] {
+			o := int(i)*m.Stride + TangentOffset
+			var got [4]float32
+			copy(got[:], m.VertexData[o:o+4])
+			for k := range got {
+				if d := got[k] - want[k]; d > 1e-5 || d < -1e-5 {
+					t.Errorf("triangle %d vertex %d has tangent %v, want %v", f, i, got, want)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// Projection selects how GenerateTexCoords maps positions to texture
+// coordinates.
+type Projection int
+
+const (
+	// NoProjection keeps the texture coordinates of the model.
+	NoProjection Projection = iota
+	// PlanarProjection projects onto the plane of the two largest extents
+	// of the model, scaled to fill [0, 1].
+	PlanarProjection
+	// BoxProjection projects each triangle onto the side of the bounding
+	// box its normal faces most, as triplanar mapping does, with the same
+	// scale on every side.
+	BoxProjection
+	// SphericalProjection maps longitude around the Y axis to U and
+	// latitude to V, from the center of the model.
+	SphericalProjection
+	// CylindricalProjection maps the angle around the Y axis to U and the
+	// height to V.
+	CylindricalProjection
+)
+
+var projectionNames = [...]string{"none", "planar", "box", "spherical", "cylindrical"}
+
+func (p Projection) String() string {
+	if p < 0 || int(p) >= len(projectionNames) {
+		return fmt.Sprintf("Projection(%d)", int(p))
+	}
+	return projectionNames[p]
+}
+
+// ParseProjection returns the Projection with the given name.
+func ParseProjection(s string) (Projection, error) {
+	for i, name := range projectionNames {
+		if s == name {
+			return Projection(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown projection: %s", s)
+}
+
+// GenerateTexCoords replaces the texture coordinates of m with ones
+// projected from its positions.  Vertices on the seams of box, spherical
+// and cylindrical projections are split, so each triangle is mapped without
+// wrapping around the texture.  Group transforms are applied first, so the
+// parts of a model are projected together, and tangents are generated
+// again if m has them.
+func (m *Model) GenerateTexCoords(p Projection) {
+	if p == NoProjection || m.VertexCount == 0 {
+		return
+	}
+	m.Bake()
+	if p == PlanarProjection {
+		m.planarTexCoords()
+	} else {
+		m.projectTexCoords(p)
+	}
+	m.HasTexCoords = true
+	if m.HasTangents {
+		m.GenerateTangents()
+	}
+}
+
+// vertexBounds returns the minimum and maximum corners of the box enclosing
+// the vertices of m, ignoring group transforms.
+func (m *Model) vertexBounds() (min, max [3]float32) {
+	min, max = m.vec3(0, PositionOffset), m.vec3(0, PositionOffset)
+	for i := 1; i < m.VertexCount; i++ {
+		p := m.vec3(uint32(i), PositionOffset)
+		for k := range p {
+			min[k] = float32(math.Min(float64(min[k]), float64(p[k])))
+			max[k] = float32(math.Max(float64(max[k]), float64(p[k])))
+		}
+	}
+	return min, max
+}
+
+// planarTexCoords projects each vertex onto the plane of the two largest
+// extents of the model, scaled to fill [0, 1].
+func (m *Model) planarTexCoords() {
+	if m.VertexCount == 0 {
+		return
+	}
+	min, max := m.vertexBounds()
+
+	// Drop the axis with the smallest extent.
+	u, v := 0, 1
+	size := sub3(max, min)
+	if size[0] < size[1] && size[0] < size[2] {
+		u, v = 1, 2
+	} else if size[1] < size[2] {
+		u, v = 0, 2
+	}
+	for i := 0; i < m.VertexCount; i++ {
+		p := m.vec3(uint32(i), PositionOffset)
+		o := i*m.Stride + TexCoordOffset
+		if size[u] > 0 {
+			m.VertexData[o] = (p[u] - min[u]) / size[u]
+		}
+		if size[v] > 0 {
+			m.VertexData[o+1] = (p[v] - min[v]) / size[v]
+		}
+	}
+}
+
+// projectTexCoords sets the texture coordinates of each corner of each
+// triangle by a projection that may differ between the triangles sharing a
+// vertex, splitting the vertices whose corners differ.
+func (m *Model) projectTexCoords(p Projection) {
+	min, max := m.vertexBounds()
+	size := sub3(max, min)
+	extent := float32(math.Max(float64(size[0]), math.Max(float64(size[1]), float64(size[2]))))
+	if extent == 0 {
+		extent = 1
+	}
+	var center [3]float32
+	for k := range center {
+		center[k] = (min[k] + max[k]) / 2
+	}
+
+	// around returns the angle of p around the Y axis as a fraction of a
+	// turn, increasing to the right seen from outside, and whether p is on
+	// the axis, where the angle is undefined.
+	around := func(p [3]float32) (float32, bool) {
+		x, z := float64(p[0]-center[0]), float64(p[2]-center[2])
+		if math.Hypot(x, z) <= 1e-6*float64(extent) {
+			return 0, true
+		}
+		return float32(0.5 + math.Atan2(x, z)/(2*math.Pi)), false
+	}
+
+	faces := m.faceNormals()
+	uvs := make([][2]float32, len(m.FaceData))
+	for t, n := range faces {
+		corner := m.FaceData[3*t : 3*t+3]
+		uv := uvs[3*t : 3*t+3]
+		switch p {
+		case BoxProjection:
+			for k, v := range corner {
+				uv[k] = boxTexCoord(m.vec3(v, PositionOffset), n, min, max, extent)
+			}
+			continue
+		case SphericalProjection:
+			for k, v := range corner {
+				d := sub3(m.vec3(v, PositionOffset), center)
+				if l := length3(d); l > 0 {
+					uv[k][1] = float32(0.5 + math.Asin(float64(d[1]/l))/math.Pi)
+				}
+			}
+		case CylindricalProjection:
+			for k, v := range corner {
+				if size[1] > 0 {
+					uv[k][1] = (m.vec3(v, PositionOffset)[1] - min[1]) / size[1]
+				}
+			}
+		}
+
+		// Corners on the axis take the mean U of the others, and U wraps
+		// to beyond 1 for triangles crossing the seam, which span less
+		// of the texture wrapped than not.
+		var onAxis [3]bool
+		lo, hi := float32(1), float32(0)
+		wrappedLo, wrappedHi := float32(2), float32(0)
+		for k, v := range corner {
+			uv[k][0], onAxis[k] = around(m.vec3(v, PositionOffset))
+			if onAxis[k] {
+				continue
+			}
+			u, wrapped := uv[k][0], uv[k][0]
+			if wrapped < 0.5 {
+				wrapped++
+			}
+			lo, hi = float32(math.Min(float64(lo), float64(u))), float32(math.Max(float64(hi), float64(u)))
+			wrappedLo, wrappedHi = float32(math.Min(float64(wrappedLo), float64(wrapped))), float32(math.Max(float64(wrappedHi), float64(wrapped)))
+		}
+		wrap := hi-lo > 0.5 && wrappedHi-wrappedLo < hi-lo
+		var sum float32
+		count := 0
+		for k := range uv {
+			if onAxis[k] {
+				continue
+			}
+			if wrap && uv[k][0] < 0.5 {
+				uv[k][0]++
+			}
+			sum += uv[k][0]
+			count++
+		}
+		for k := range uv {
+			if onAxis[k] && count > 0 {
+				uv[k][0] = sum / float32(count)
+			}
+		}
+	}
+
+	type key struct {
+		vertex uint32
+		uv     [2]float32
+	}
+	split := make(map[key]uint32)
+	used := make([]bool, m.VertexCount)
+	for c, v := range m.FaceData {
+		k := key{v, uvs[c]}
+		if i, ok := split[k]; ok {
+			m.FaceData[c] = i
+			continue
+		}
+		i := v
+		if used[v] {
+			i = uint32(m.VertexCount)
+			m.VertexData = append(m.VertexData, m.VertexData[int(v)*m.Stride:int(v+1)*m.Stride]...)
+			m.VertexCount++
+		}
+		used[v] = true
+		copy(m.VertexData[int(i)*m.Stride+TexCoordOffset:], k.uv[:])
+		split[k] = i
+		m.FaceData[c] = i
+	}
+}
+
+// boxTexCoord returns the texture coordinates of p on the side of the box
+// from min to max facing most along n, oriented as seen from outside the
+// box with Y, or -Z on the top and bottom, pointing up.
+func boxTexCoord(p, n, min, max [3]float32, extent float32) [2]float32 {
+	a := [3]float32{float32(math.Abs(float64(n[0]))), float32(math.Abs(float64(n[1]))), float32(math.Abs(float64(n[2])))}
+	var u, v float32
+	switch {
+	case a[0] >= a[1] && a[0] >= a[2]:
+		u, v = p[2]-min[2], p[1]-min[1]
+		if n[0] > 0 {
+			u = max[2] - p[2]
+		}
+	case a[1] >= a[2]:
+		u, v = p[0]-min[0], max[2]-p[2]
+		if n[1] < 0 {
+			v = p[2] - min[2]
+		}
+	default:
+		u, v = p[0]-min[0], p[1]-min[1]
+		if n[2] < 0 {
+			u = max[0] - p[0]
+		}
+	}
+	return [2]float32{u / extent, v / extent}
+}
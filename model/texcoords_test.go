@@ -0,0 +1,80 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestGenerateTexCoords(t *testing.T) {
+	for _, p := range []Projection{PlanarProjection, BoxProjection, SphericalProjection, CylindricalProjection} {
+		m := New()
+		if err := m.LoadFile(BuiltinPrefix + "icosphere"); err != nil {
+			t.Fatal(err)
+		}
+		vertices := m.VertexCount
+		m.GenerateTexCoords(p)
+		if !m.HasTexCoords || !m.HasTangents {
+			t.Errorf("%s: got texture coordinates %t and tangents %t, want both", p, m.HasTexCoords, m.HasTangents)
+		}
+		if p != PlanarProjection && m.VertexCount <= vertices {
+			t.Errorf("%s: got %d vertices, want those on seams split from %d", p, m.VertexCount, vertices)
+		}
+
+		// No triangle wraps around the texture, and V stays within it.
+		for f := 0; f < m.FaceCount; f++ {
+			lo, hi := float32(2), float32(-1)
+			for _, i := range m.FaceData[3*f : 3*f+3] {
+				u, v := m.texCoord(i)
+				if v < 0 || v > 1 {
+					t.Fatalf("%s: vertex %d has V %g, want it within [0, 1]", p, i, v)
+				}
+				if u < lo {
+					lo = u
+				}
+				if u > hi {
+					hi = u
+				}
+			}
+			if hi-lo > 0.25 {
+				t.Fatalf("%s: triangle %d spans U from %g to %g", p, f, lo, hi)
+			}
+		}
+	}
+}
+
+func TestCylindricalTexCoords(t *testing.T) {
+	m := New()
+	if err := m.LoadFile(BuiltinPrefix + "cylinder"); err != nil {
+		t.Fatal(err)
+	}
+	m.GenerateTexCoords(CylindricalProjection)
+	min, max := m.Bounds()
+	for i := uint32(0); i < uint32(m.VertexCount); i++ {
+		y := m.vec3(i, PositionOffset)[1]
+		if _, v := m.texCoord(i); v != (y-min[1])/(max[1]-min[1]) {
+			t.Errorf("vertex %d at height %g has V %g", i, y, v)
+		}
+	}
+}
+
+func TestParseProjection(t *testing.T) {
+	for _, p := range []Projection{NoProjection, PlanarProjection, BoxProjection, SphericalProjection, CylindricalProjection} {
+		if got, err := ParseProjection(p.String()); err != nil || got != p {
+			t.Errorf("ParseProjection(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseProjection("cubic"); err == nil {
+		t.Error("ParseProjection accepted an unknown projection")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"strconv"
+)
+
+// The text formats are tokenized in place, without allocating for each line
+// or value, as models may hold millions of them.
+
+// spaces marks the bytes separating fields.
+var spaces = [256]bool{' ': true, '\t': true, '\n': true, '\r': true, '\v': true, '\f': true}
+
+func isSpace(b byte) bool {
+	return spaces[b]
+}
+
+// splitFields appends the whitespace separated fields of line to dst.  The
+// fields share the memory of line.
+func splitFields(dst [][]byte, line []byte) [][]byte {
+	for i := 0; i < len(line); {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		if i > start {
+			dst = append(dst, line[start:i])
+		}
+	}
+	return dst
+}
+
+// isBlank reports whether line holds only whitespace.
+func isBlank(line []byte) bool {
+	for _, b := range line {
+		if !isSpace(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimEOL returns line without its trailing line ending.
+func trimEOL(line []byte) []byte {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// pow10 holds the powers of ten that are exactly representable as float64.
+var pow10 = [...]float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22,
+}
+
+// parseFloat parses a decimal number from b.  Numbers with at most 15
+// significant digits and small exponents, as written by most tools, are
+// converted exactly with a single multiplication or division; others are
+// left to strconv.
+func parseFloat(b []byte) (float64, bool) {
+	i := 0
+	neg := false
+	if i < len(b) && (b[i] == '+' || b[i] == '-') {
+		neg = b[i] == '-'
+		i++
+	}
+	var mant uint64
+	digits, exp := 0, 0
+	sawDigit, sawDot := false, false
+	for ; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c >= '0' && c <= '9':
+			sawDigit = true
+			if mant == 0 && c == '0' {
+				if sawDot {
+					exp--
+				}
+				continue
+			}
+			if digits == 15 {
+				return parseFloatSlow(b)
+			}
+			mant = mant*10 + uint64(c-'0')
+			digits++
+			if sawDot {
+				exp--
+			}
+		case c == '.' && !sawDot:
+			sawDot = true
+		case c == 'e' || c == 'E':
+			if !sawDigit {
+				return 0, false
+			}
+			e, ok := parseInt(b[i+1:], 16, true)
+			if !ok {
+				return parseFloatSlow(b)
+			}
+			exp += int(e)
+			i = len(b)
+		default:
+			return parseFloatSlow(b)
+		}
+	}
+	if !sawDigit {
+		return parseFloatSlow(b)
+	}
+
+	f := float64(mant)
+	switch {
+	case mant == 0:
+	case exp >= 0 && exp < len(pow10):
+		f *= pow10[exp]
+	case exp < 0 && -exp < len(pow10):
+		f /= pow10[-exp]
+	default:
+		return parseFloatSlow(b)
+	}
+	if neg {
+		f = -f
+	}
+	return f, true
+}
+
+// parseFloatSlow parses the numbers parseFloat cannot convert exactly
+// itself, including infinities and NaN.
+func parseFloatSlow(b []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(b), 64)
+	return f, err == nil
+}
+
+// parseInt parses a decimal integer from b that fits in the given number of
+// bits, at most 32, allowing a sign only when signed is set.
+func parseInt(b []byte, bits uint, signed bool) (int64, bool) {
+	i := 0
+	neg := false
+	if signed && i < len(b) && (b[i] == '+' || b[i] == '-') {
+		neg = b[i] == '-'
+		i++
+	}
+	if i == len(b) {
+		return 0, false
+	}
+	var n int64
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		if n = n*10 + int64(c-'0'); n > math.MaxUint32 {
+			return 0, false
+		}
+	}
+	if neg {
+		n = -n
+	}
+	if signed {
+		if n < -1<<(bits-1) || n > 1<<(bits-1)-1 {
+			return 0, false
+		}
+	} else if n > 1<<bits-1 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestParseFloat(t *testing.T) {
+	tests := []string{
+		"0", "-0", "+0", "0.0", "-0.0", "00", ".5", "5.", "-.5", "+1.5",
+		"1", "-1", "123456789", "0.1", "0.2", "0.3", "1.0000001", "3.14159265358979",
+		"123456789012345", "1234567890123456", "12345678901234567890", "0.000000000000000000001",
+		"9007199254740993", "0.1234567890123456789", "100000000000000000000000",
+		"1e0", "1e5", "1E5", "1e+5", "1e-5", "-1.5e-3", "2.5e22", "2.5e23", "1e-22", "1e-23",
+		"123.456e-20", "4.9e-324", "5e-325", "2.2250738585072014e-308", "1.7976931348623157e308",
+		"1e308", "1e309", "-1e309", "1e-400", "1e99999", "1e-99999", "1e400000",
+		"inf", "-inf", "+Inf", "Infinity", "nan", "NaN",
+		"", "-", "+", ".", "e", "e5", ".e5", "1e", "1e+", "1e-", "1.2.3", "1ee5", "1e5.5",
+		"--1", "+-1", "1-", "0x10", "0x1p3", "1_000", "1,5", "1 ", " 1", "a",
+	}
+	// Values as written by exporters, in each notation they use.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		v := (r.Float64() - 0.5) * math.Pow(10, float64(r.Intn(20)-10))
+		for _, format := range []byte{'f', 'e', 'g'} {
+			tests = append(tests,
+				strconv.FormatFloat(v, format, -1, 32),
+				strconv.FormatFloat(v, format, -1, 64),
+				strconv.FormatFloat(v, format, r.Intn(10), 64))
+		}
+	}
+	for _, s := range tests {
+		want, err := strconv.ParseFloat(s, 64)
+		got, ok := parseFloat([]byte(s))
+		if ok != (err == nil) {
+			t.Errorf("parseFloat(%q) succeeded %t, strconv.ParseFloat: %v", s, ok, err)
+			continue
+		}
+		if ok && math.Float64bits(got) != math.Float64bits(want) && !(math.IsNaN(got) && math.IsNaN(want)) {
+			t.Errorf("parseFloat(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []string{
+		"0", "-0", "+0", "1", "-1", "+1", "007", "127", "128", "-128", "-129",
+		"255", "256", "32767", "32768", "-32768", "-32769", "65535", "65536",
+		"2147483647", "2147483648", "-2147483648", "-2147483649",
+		"4294967295", "4294967296", "18446744073709551616", "99999999999999999999999",
+		"", "-", "+", "1.0", "1e3", "0x10", "1_000", " 1", "1 ", "--1", "a",
+	}
+	for _, bits := range []uint{8, 16, 32} {
+		for _, signed := range []bool{true, false} {
+			for _, s := range tests {
+				var want int64
+				var err error
+				if signed {
+					want, err = strconv.ParseInt(s, 10, int(bits))
+				} else {
+					var u uint64
+					u, err = strconv.ParseUint(s, 10, int(bits))
+					want = int64(u)
+				}
+				got, ok := parseInt([]byte(s), bits, signed)
+				if ok != (err == nil) || ok && got != want {
+					t.Errorf("parseInt(%q, %d, %t) = %d, %t, want %d, %v", s, bits, signed, got, ok, want, err)
+				}
+			}
+		}
+	}
+}
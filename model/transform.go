@@ -0,0 +1,165 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "fmt"
+
+// Transform applies the column-major matrix t to the positions, normals and
+// tangents of m.  Transforms that mirror the model also reverse the winding
+// of its triangles, so they remain front facing.  When groups of m have
+// transforms, t is applied to those instead, leaving the vertices as they
+// are.  Skinned groups keep the identity, with t applied by their skins.
+func (m *Model) Transform(t [16]float32) {
+	if m.HasTransforms() {
+		for i := range m.Groups {
+			g := &m.Groups[i]
+			if g.Skin < 0 {
+				g.Transform = mul4(t, g.Transform)
+				continue
+			}
+			for c := 3 * g.First; det3(t) < 0 && c < 3*(g.First+g.Count); c += 3 {
+				m.FaceData[c+1], m.FaceData[c+2] = m.FaceData[c+2], m.FaceData[c+1]
+			}
+		}
+		m.transformSkins(t, false)
+		return
+	}
+	n, deltas := normalMatrix(t), m.morphDeltas()
+	for i := 0; i < m.VertexCount; i++ {
+		m.transformVertex(uint32(i), t, n, deltas)
+	}
+	m.transformSkins(t, true)
+	if det3(t) < 0 {
+		m.FlipWinding()
+	}
+}
+
+// transformVertex applies t to vertex i, with n the normal matrix of t.
+// The morph target deltas at the given offsets are transformed along with
+// it, scaled as its normal and tangent are to stay unit length.
+func (m *Model) transformVertex(i uint32, t, n [16]float32, deltas [][3]int) {
+	normal := transformVector(n, m.vec3(i, NormalOffset))
+	tangent := transformVector(t, m.vec3(i, TangentOffset))
+	for _, d := range deltas {
+		for k, v := range []struct {
+			t     [16]float32
+			scale float32
+		}{{t, 1}, {n, length3(normal)}, {t, length3(tangent)}} {
+			if d[k] >= 0 && v.scale > 0 {
+				delta := transformVector(v.t, m.vec3(i, d[k]))
+				m.setVec3(i, d[k], [3]float32{delta[0] / v.scale, delta[1] / v.scale, delta[2] / v.scale})
+			}
+		}
+	}
+	m.setVec3(i, PositionOffset, transformPoint(t, m.vec3(i, PositionOffset)))
+	m.setVec3(i, NormalOffset, normalize3(normal))
+	m.setVec3(i, TangentOffset, normalize3(tangent))
+	if det3(t) < 0 {
+		m.VertexData[int(i)*m.Stride+TangentOffset+3] *= -1
+	}
+}
+
+// FlipWinding reverses the order of the vertices of each triangle, turning
+// front faces into back faces.
+func (m *Model) FlipWinding() {
+	for t := 0; t < len(m.FaceData); t += 3 {
+		m.FaceData[t+1], m.FaceData[t+2] = m.FaceData[t+2], m.FaceData[t+1]
+	}
+}
+
+// FlipV flips the texture coordinates of m vertically, moving their origin
+// between the bottom left and the top left.  The handedness of the tangents
+// is reversed to match.
+func (m *Model) FlipV() {
+	if !m.HasTexCoords {
+		return
+	}
+	offsets := []int{TexCoordOffset + 1}
+	if a, ok := m.Attribute(TexCoord1Attribute); ok {
+		offsets = append(offsets, a.Offset+1)
+	}
+	for i := 0; i < m.VertexCount; i++ {
+		v := m.VertexData[i*m.Stride : (i+1)*m.Stride]
+		for _, o := range offsets {
+			v[o] = 1 - v[o]
+		}
+		v[TangentOffset+3] *= -1
+	}
+}
+
+// UpAxis is the axis pointing up in a model.  Models are displayed Y up.
+type UpAxis int
+
+const (
+	// YUp leaves the model as it is.
+	YUp UpAxis = iota
+	// ZUp rotates the model about X, for models from the many CAD and
+	// modelling tools that are Z up.
+	ZUp
+	// XUp rotates the model about Z.
+	XUp
+)
+
+var upAxisNames = [...]string{"y", "z", "x"}
+
+// upTransforms rotate each axis to Y, keeping the model right-handed.
+var upTransforms = [...][16]float32{
+	YUp: ident4(),
+	ZUp: {1, 0, 0, 0, 0, 0, -1, 0, 0, 1, 0, 0, 0, 0, 0, 1},
+	XUp: {0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1},
+}
+
+func (a UpAxis) String() string {
+	if a < 0 || int(a) >= len(upAxisNames) {
+		return fmt.Sprintf("UpAxis(%d)", int(a))
+	}
+	return upAxisNames[a]
+}
+
+// ParseUpAxis returns the UpAxis with the given name.
+func ParseUpAxis(s string) (UpAxis, error) {
+	for i, name := range upAxisNames {
+		if s == name {
+			return UpAxis(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown up axis: %s", s)
+}
+
+// convert applies the conversions given by opts to a model just loaded.
+func (m *Model) convert(opts LoadOptions) {
+	t := ident4()
+	if opts.Up > 0 && int(opts.Up) < len(upTransforms) {
+		t = upTransforms[opts.Up]
+	}
+	if opts.Scale != 0 {
+		s := ident4()
+		s[0], s[5], s[10] = opts.Scale, opts.Scale, opts.Scale
+		t = mul4(s, t)
+	}
+	if opts.Matrix != [16]float32{} {
+		t = mul4(opts.Matrix, t)
+	}
+	if t != ident4() {
+		m.Transform(t)
+	}
+	if opts.FlipWinding {
+		m.FlipWinding()
+	}
+	m.GenerateTexCoords(opts.TexCoords)
+	if opts.FlipV {
+		m.FlipV()
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zUpTriangle is a triangle standing up in a Z up model, facing -Y.
+const zUpTriangle = `v 0 0 0
+v 1 0 0
+v 0 0 1
+vt 0 0
+vt 1 0
+vt 0 0.25
+vn 0 -1 0
+f 1/1/1 2/2/1 3/3/1
+`
+
+func TestLoadConversions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     LoadOptions
+		top      [3]float32 // Position of the third vertex.
+		normal   [3]float32
+		v        float32 // V of the third vertex.
+		faces    []uint32
+		tangentW float32
+	}{
+		{"none", LoadOptions{}, [3]float32{0, 0, 1}, [3]float32{0, -1, 0}, 0.25, []uint32{0, 1, 2}, 1},
+		{"z up", LoadOptions{Up: ZUp}, [3]float32{0, 1, 0}, [3]float32{0, 0, 1}, 0.25, []uint32{0, 1, 2}, 1},
+		{"scale", LoadOptions{Up: ZUp, Scale: 2}, [3]float32{0, 2, 0}, [3]float32{0, 0, 1}, 0.25, []uint32{0, 1, 2}, 1},
+		{"matrix", LoadOptions{Up: ZUp, Matrix: [16]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 5, 0, 0, 1}}, [3]float32{5, 1, 0}, [3]float32{0, 0, 1}, 0.25, []uint32{0, 1, 2}, 1},
+		// Mirroring reverses the winding, keeping the triangle front
+		// facing, and the handedness of the tangents.
+		{"mirror", LoadOptions{Matrix: [16]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, -1, 0, 0, 0, 0, 1}}, [3]float32{0, 0, -1}, [3]float32{0, -1, 0}, 0.25, []uint32{0, 2, 1}, -1},
+		{"flip winding", LoadOptions{FlipWinding: true}, [3]float32{0, 0, 1}, [3]float32{0, -1, 0}, 0.25, []uint32{0, 2, 1}, 1},
+		{"flip v", LoadOptions{FlipV: true}, [3]float32{0, 0, 1}, [3]float32{0, -1, 0}, 0.75, []uint32{0, 1, 2}, -1},
+	}
+	for _, test := range tests {
+		m := New()
+		if err := m.Load(strings.NewReader(zUpTriangle)); err != nil {
+			t.Fatal(err)
+		}
+		// Tangents are generated before converting, as a loader would
+		// read them.
+		m.GenerateTangents()
+		var buf strings.Builder
+		if err := encodePLY(m, &buf, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.LoadWith(strings.NewReader(buf.String()), test.opts); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if p := m.vec3(2, PositionOffset); p != test.top {
+			t.Errorf("%s: vertex 2 is at %v, want %v", test.name, p, test.top)
+		}
+		if n := m.vec3(2, NormalOffset); n != test.normal {
+			t.Errorf("%s: vertex 2 has normal %v, want %v", test.name, n, test.normal)
+		}
+		if _, v := m.texCoord(2); v != test.v {
+			t.Errorf("%s: vertex 2 has V %g, want %g", test.name, v, test.v)
+		}
+		if !reflect.DeepEqual(m.FaceData, test.faces) {
+			t.Errorf("%s: got faces %v, want %v", test.name, m.FaceData, test.faces)
+		}
+		if w := m.VertexData[2*m.Stride+TangentOffset+3]; w != test.tangentW {
+			t.Errorf("%s: vertex 2 has tangent handedness %g, want %g", test.name, w, test.tangentW)
+		}
+	}
+}
+
+func TestParseUpAxis(t *testing.T) {
+	for _, a := range []UpAxis{YUp, ZUp, XUp} {
+		if got, err := ParseUpAxis(a.String()); err != nil || got != a {
+			t.Errorf("ParseUpAxis(%q) = %v, %v, want %v", a.String(), got, err, a)
+		}
+	}
+	if _, err := ParseUpAxis("w"); err == nil {
+		t.Error("ParseUpAxis accepted an unknown axis")
+	}
+}
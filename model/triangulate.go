@@ -0,0 +1,177 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// setFaces triangulates the polygons, given as concatenated vertex indices
+// and the number of vertices in each, into FaceData.  The number of vertices
+// in each is kept in Polygons.
+func (m *Model) setFaces(polygons []uint32, counts []int) error {
+	for _, i := range polygons {
+		if int(i) >= m.VertexCount {
+			return fmt.Errorf("vertex index %d out of range", i)
+		}
+	}
+
+	m.FaceData = make([]uint32, 0, 3*len(counts))
+	for _, c := range counts {
+		m.FaceData = m.triangulate(m.FaceData, polygons[:c])
+		polygons = polygons[c:]
+	}
+	m.FaceCount = len(m.FaceData) / 3
+	m.Polygons = polygonCounts(counts)
+	return nil
+}
+
+// polygonsMatch reports whether Polygons covers exactly the faces of m.
+func (m Model) polygonsMatch() bool {
+	n := 0
+	for _, c := range m.Polygons {
+		if c < 3 {
+			return false
+		}
+		n += c - 2
+	}
+	return n == m.FaceCount
+}
+
+// polygonCounts returns counts, the number of vertices of each polygon, or
+// nil if every polygon is a triangle.
+func polygonCounts(counts []int) []int {
+	for _, c := range counts {
+		if c > 3 {
+			return counts
+		}
+	}
+	return nil
+}
+
+// triangulate appends triangles covering poly to tris, always two fewer than
+// its vertices.  Convex polygons are split into a fan, concave polygons are
+// ear clipped.
+func (m *Model) triangulate(tris []uint32, poly []uint32) []uint32 {
+	if len(poly) == 3 {
+		return append(tris, poly...)
+	}
+
+	pts := m.project(poly)
+	if convex(pts) {
+		for i := 1; i < len(poly)-1; i++ {
+			tris = append(tris, poly[0], poly[i], poly[i+1])
+		}
+		return tris
+	}
+
+	// Ear clipping: repeatedly cut off a convex corner whose triangle
+	// contains no other remaining vertex.
+	remaining := make([]int, len(poly))
+	for i := range remaining {
+		remaining[i] = i
+	}
+	for len(remaining) > 3 {
+		n := len(remaining)
+		ear := -1
+		for i := 0; i < n && ear < 0; i++ {
+			a, b, c := remaining[(i+n-1)%n], remaining[i], remaining[(i+1)%n]
+			if cross(pts[a], pts[b], pts[c]) <= 0 {
+				continue
+			}
+			ear = i
+			for _, j := range remaining {
+				if j != a && j != b && j != c && inTriangle(pts[j], pts[a], pts[b], pts[c]) {
+					ear = -1
+					break
+				}
+			}
+		}
+		if ear < 0 {
+			// Degenerate or self intersecting, fan what is left.
+			break
+		}
+		a, b, c := remaining[(ear+n-1)%n], remaining[ear], remaining[(ear+1)%n]
+		tris = append(tris, poly[a], poly[b], poly[c])
+		remaining = append(remaining[:ear], remaining[ear+1:]...)
+	}
+	for i := 1; i < len(remaining)-1; i++ {
+		tris = append(tris, poly[remaining[0]], poly[remaining[i]], poly[remaining[i+1]])
+	}
+	return tris
+}
+
+// project maps the vertices of poly onto the 2D plane that best preserves
+// their layout, oriented so that the polygon winds counter-clockwise.
+func (m *Model) project(poly []uint32) [][2]float64 {
+	// Newell's method for the polygon normal.
+	var n [3]float64
+	for i := range poly {
+		a := m.position(poly[i])
+		b := m.position(poly[(i+1)%len(poly)])
+		n[0] += (a[1] - b[1]) * (a[2] + b[2])
+		n[1] += (a[2] - b[2]) * (a[0] + b[0])
+		n[2] += (a[0] - b[0]) * (a[1] + b[1])
+	}
+
+	// Drop the dominant axis of the normal.
+	u, v, axis := 1, 2, 0
+	if math.Abs(n[1]) > math.Abs(n[axis]) {
+		u, v, axis = 2, 0, 1
+	}
+	if math.Abs(n[2]) > math.Abs(n[axis]) {
+		u, v, axis = 0, 1, 2
+	}
+	if n[axis] < 0 {
+		u, v = v, u
+	}
+
+	pts := make([][2]float64, len(poly))
+	for i := range poly {
+		p := m.position(poly[i])
+		pts[i] = [2]float64{p[u], p[v]}
+	}
+	return pts
+}
+
+func (m *Model) position(i uint32) [3]float64 {
+	o := int(i)*m.Stride + PositionOffset
+	return [3]float64{
+		float64(m.VertexData[o]),
+		float64(m.VertexData[o+1]),
+		float64(m.VertexData[o+2]),
+	}
+}
+
+func convex(pts [][2]float64) bool {
+	n := len(pts)
+	for i := range pts {
+		if cross(pts[(i+n-1)%n], pts[i], pts[(i+1)%n]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cross returns the z component of (b-a) x (c-b), which is positive when
+// a, b, c turn counter-clockwise.
+func cross(a, b, c [2]float64) float64 {
+	return (b[0]-a[0])*(c[1]-b[1]) - (b[1]-a[1])*(c[0]-b[0])
+}
+
+func inTriangle(p, a, b, c [2]float64) bool {
+	return cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTriangulate(t *testing.T) {
+	tests := []struct {
+		name, data string
+		area       float32
+	}{
+		{"quad", "v 0 0 0\nv 2 0 0\nv 2 1 0\nv 0 1 0\nf 1 2 3 4\n", 2},
+		// Concave polygons a fan from their first vertex would cover
+		// outside of.
+		{"l", "v 2 1 0\nv 1 1 0\nv 1 2 0\nv 0 2 0\nv 0 0 0\nv 2 0 0\nf 1 2 3 4 5 6\n", 3},
+		{"dart", "v 2 0 0\nv 1 3 0\nv 0 0 0\nv 1 1 0\nf 1 2 3 4\n", 2},
+	}
+	for _, test := range tests {
+		m := New()
+		if err := m.Load(strings.NewReader(test.data)); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if want := m.VertexCount - 2; m.FaceCount != want {
+			t.Errorf("%s: got %d triangles, want %d", test.name, m.FaceCount, want)
+			continue
+		}
+		if !reflect.DeepEqual(m.Polygons, []int{m.VertexCount}) {
+			t.Errorf("%s: got polygons %v, want [%d]", test.name, m.Polygons, m.VertexCount)
+		}
+
+		// Triangles inside the polygon wound the same way cover exactly
+		// its area.
+		var area float32
+		for f := 0; f < m.FaceCount; f++ {
+			a, b, c := m.vec3(m.FaceData[3*f], PositionOffset), m.vec3(m.FaceData[3*f+1], PositionOffset), m.vec3(m.FaceData[3*f+2], PositionOffset)
+			z := cross3(sub3(b, a), sub3(c, a))[2] / 2
+			if z <= 0 {
+				t.Errorf("%s: triangle %d is wound clockwise or degenerate", test.name, f)
+			}
+			area += z
+		}
+		if d := area - test.area; d > 1e-6 || d < -1e-6 {
+			t.Errorf("%s: triangles cover %g, want %g", test.name, area, test.area)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "math"
+
+// Weld merges vertices whose attributes all differ by no more than epsilon,
+// drops triangles left with repeated vertices and drops vertices no triangle
+// uses.  An epsilon of 0 only merges identical vertices.
+func (m *Model) Weld(epsilon float32) {
+	remap := make([]uint32, m.VertexCount)
+	data := make([]float32, 0, len(m.VertexData))
+	cells := make(map[[3]int64][]uint32)
+	var neighbours [][3]int64
+	count := uint32(0)
+	for i := 0; i < m.VertexCount; i++ {
+		v := m.VertexData[i*m.Stride : (i+1)*m.Stride]
+		c := weldCell(v, epsilon)
+		found := false
+		neighbours = weldNeighbours(neighbours[:0], c, epsilon)
+		for _, n := range neighbours {
+			for _, j := range cells[n] {
+				if weldClose(data[int(j)*m.Stride:int(j+1)*m.Stride], v, epsilon) {
+					remap[i], found = j, true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			remap[i] = count
+			cells[c] = append(cells[c], count)
+			data = append(data, v...)
+			count++
+		}
+	}
+	m.VertexData = data
+	m.VertexCount = int(count)
+
+	for i, v := range m.FaceData {
+		m.FaceData[i] = remap[v]
+	}
+	m.dropTriangles(func(t int) bool {
+		f := m.FaceData[3*t : 3*t+3]
+		return f[0] == f[1] || f[1] == f[2] || f[2] == f[0]
+	})
+	m.Compact()
+}
+
+// Compact drops vertices that no triangle uses, keeping the order of the
+// rest.
+func (m *Model) Compact() {
+	used := make([]bool, m.VertexCount)
+	for _, v := range m.FaceData {
+		used[v] = true
+	}
+	remap := make([]uint32, m.VertexCount)
+	count := 0
+	for i := 0; i < m.VertexCount; i++ {
+		if !used[i] {
+			continue
+		}
+		copy(m.VertexData[count*m.Stride:], m.VertexData[i*m.Stride:(i+1)*m.Stride])
+		remap[i] = uint32(count)
+		count++
+	}
+	m.VertexData = m.VertexData[:count*m.Stride]
+	m.VertexCount = count
+	for i, v := range m.FaceData {
+		m.FaceData[i] = remap[v]
+	}
+}
+
+// ShortIndices reports whether every vertex can be addressed by a 16 bit
+// index.
+func (m Model) ShortIndices() bool {
+	return m.VertexCount <= math.MaxUint16+1
+}
+
+// FaceData16 returns FaceData as 16 bit indices.  It is only valid when
+// ShortIndices is true.
+func (m Model) FaceData16() []uint16 {
+	indices := make([]uint16, len(m.FaceData))
+	for i, v := range m.FaceData {
+		indices[i] = uint16(v)
+	}
+	return indices
+}
+
+// dropTriangles removes the triangles for which drop returns true, keeping
+// groups covering the same triangles as before.  Polygons that lose any of
+// their triangles are split into those that are left.  Drop is called for
+// each triangle in order, and may read it from FaceData.
+func (m *Model) dropTriangles(drop func(t int) bool) {
+	if !m.polygonsMatch() {
+		m.Polygons = nil
+	}
+	kept := make([]int, m.FaceCount+1)
+	faces := m.FaceData[:0]
+	for t := 0; t < m.FaceCount; t++ {
+		tri := m.FaceData[3*t : 3*t+3]
+		kept[t+1] = kept[t]
+		if !drop(t) {
+			faces = append(faces, tri...)
+			kept[t+1]++
+		}
+	}
+	m.FaceData = faces
+	m.FaceCount = len(faces) / 3
+
+	groups := m.Groups[:0]
+	for _, g := range m.Groups {
+		first, last := kept[g.First], kept[g.First+g.Count]
+		if g.First, g.Count = first, last-first; g.Count > 0 {
+			groups = append(groups, g)
+		}
+	}
+	m.Groups = groups
+
+	var polygons []int
+	t := 0
+	for _, n := range m.Polygons {
+		left := kept[t+n-2] - kept[t]
+		if left == n-2 {
+			polygons = append(polygons, n)
+		} else {
+			for i := 0; i < left; i++ {
+				polygons = append(polygons, 3)
+			}
+		}
+		t += n - 2
+	}
+	m.Polygons = polygonCounts(polygons)
+}
+
+// weldCell returns the grid cell of v's position.  Without an epsilon, the
+// cell is the position itself.
+func weldCell(v []float32, epsilon float32) [3]int64 {
+	var c [3]int64
+	for k := range c {
+		p := v[PositionOffset+k]
+		if p == 0 {
+			p = 0 // Treat -0 as 0.
+		}
+		if epsilon > 0 {
+			c[k] = int64(math.Floor(float64(p / epsilon)))
+		} else {
+			c[k] = int64(math.Float32bits(p))
+		}
+	}
+	return c
+}
+
+// weldNeighbours appends the cells that may hold vertices within epsilon of
+// those in c to n.
+func weldNeighbours(n [][3]int64, c [3]int64, epsilon float32) [][3]int64 {
+	if epsilon <= 0 {
+		return append(n, c)
+	}
+	for x := int64(-1); x <= 1; x++ {
+		for y := int64(-1); y <= 1; y++ {
+			for z := int64(-1); z <= 1; z++ {
+				n = append(n, [3]int64{c[0] + x, c[1] + y, c[2] + z})
+			}
+		}
+	}
+	return n
+}
+
+func weldClose(a, b []float32, epsilon float32) bool {
+	for k := range a {
+		if d := a[k] - b[k]; d > epsilon || d < -epsilon {
+			return false
+		}
+	}
+	return true
+}
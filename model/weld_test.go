@@ -0,0 +1,72 @@
+// Copyright 2016 Richard Hawkins
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestWeld(t *testing.T) {
+	// A quad whose triangles each have their own vertices, one moved by
+	// less than the epsilon, a triangle collapsing once welded and an
+	// unused vertex.
+	m := New()
+	positions := [][3]float32{
+		{0, 0, 0}, {1, 0, 0}, {1, 1, 0},
+		{0, 0, 0}, {1, 1.0005, 0}, {0, 1, 0},
+		{0, 0, 0}, {0, 0, 0}, {1, 0, 0},
+		{5, 5, 5},
+	}
+	for _, p := range positions {
+		v := make([]float32, VertexSize)
+		copy(v, p[:])
+		m.VertexData = append(m.VertexData, v...)
+	}
+	m.VertexCount = len(positions)
+	m.FaceData = []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8}
+	m.FaceCount = 3
+
+	exact := m.Clone()
+	exact.Weld(0)
+	if exact.VertexCount != 5 || exact.FaceCount != 2 {
+		t.Errorf("welded exactly into %d vertices and %d faces, want 5 and 2", exact.VertexCount, exact.FaceCount)
+	}
+
+	m.Weld(0.001)
+	if m.VertexCount != 4 || m.FaceCount != 2 {
+		t.Fatalf("welded into %d vertices and %d faces, want 4 and 2", m.VertexCount, m.FaceCount)
+	}
+	if want := []uint32{0, 1, 2, 0, 2, 3}; !reflect.DeepEqual(m.FaceData, want) {
+		t.Errorf("got faces %v, want %v", m.FaceData, want)
+	}
+}
+
+func TestFaceData16(t *testing.T) {
+	m := New()
+	m.VertexCount = math.MaxUint16 + 1
+	m.FaceData = []uint32{0, 1, math.MaxUint16}
+	if !m.ShortIndices() {
+		t.Errorf("%d vertices do not fit 16 bit indices", m.VertexCount)
+	}
+	if got := m.FaceData16(); !reflect.DeepEqual(got, []uint16{0, 1, math.MaxUint16}) {
+		t.Errorf("got 16 bit indices %v, want [0 1 65535]", got)
+	}
+	m.VertexCount++
+	if m.ShortIndices() {
+		t.Errorf("%d vertices fit 16 bit indices", m.VertexCount)
+	}
+}
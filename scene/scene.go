@@ -16,13 +16,19 @@
 package scene
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/draw"
-	_ "image/png" // register PNG decode
+	_ "image/jpeg" // register JPEG decode
+	_ "image/png"  // register PNG decode
 	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.1/glfw"
@@ -37,13 +43,9 @@ const ( // Program IDs
 	numPrograms = iota
 )
 
-const ( // VAO Names
-	triangleName = iota // VAO
-	numVAOs      = iota
-)
-
 const ( // Buffer Names
 	aBufferName = iota // Array Buffer
+	eBufferName = iota // Element Array Buffer
 	numBuffers  = iota
 )
 
@@ -54,18 +56,38 @@ const ( // Texture ID/Names?
 )
 
 const ( // Attrib Locations
-	mcVertexLoc = 0
-	mcNormalLoc = 1
-	texCoord0   = 2
+	mcVertexLoc  = 0
+	mcNormalLoc  = 1
+	texCoord0    = 2
+	mcTangentLoc = 3
 )
 
 type Scene struct {
 	// Config vars
-	ModelFile  string
-	ColorFile  string
-	NormalFile string
-	VertFiles  []string
-	FragFiles  []string
+	ModelFile   string
+	ColorFile   string
+	NormalFile  string
+	VertFiles   []string
+	FragFiles   []string
+	Normals     string  // Normal mode to generate, empty to use the model's.
+	CreaseAngle float64 // Crease angle in degrees for crease normals.
+	Fit         bool    // Fit the model to the view, else fit the view to it.
+	Weld        bool    // Weld vertices closer than WeldEpsilon.
+	WeldEpsilon float64
+	Optimize    bool // Reorder triangles and vertices for a vertex cache.
+	CacheSize   int
+	LODRatios   []float64         // Levels of detail to build, as ratios of the model's triangles.
+	LoadOptions model.LoadOptions // How ModelFile is read.
+
+	// Subdivision
+	Subdivision       string  // Subdivision scheme, empty for none.
+	Subdivisions      int     // Number of times to subdivide.
+	SubdivisionCrease float64 // Angle in degrees above which edges stay sharp.
+
+	// Animation
+	Animation    string    // Name or index of the animation played, empty for the first.
+	Paused       bool      // Hold the animation where it is.
+	MorphWeights []float32 // Weights of the morph targets at rest, overriding the model's.
 
 	// Input
 	MouseX    float32
@@ -73,14 +95,29 @@ type Scene struct {
 	MouseLeft bool
 
 	// Model
-	Model model.Model
-	Angle mgl32.Vec3
+	Source  model.Model   // As loaded.
+	Model   model.Model   // As displayed.
+	LODs    []model.Model // Levels of detail, the first being the full model.
+	LOD     int           // Level of detail displayed.
+	Angle   mgl32.Vec3
+	rebuild bool
+
+	// Skinning
+	Playing       int             // Index of the animation played, -1 for none.
+	Time          float32         // Time into the animation played, in seconds.
+	JointMatrices [][][16]float32 // Joint matrices of each skin, as posed.
+	MaxJoints     int             // Joint matrices the shader holds.
+
+	// Morph Targets
+	Weights   []float32 // Weight of each morph target, as posed.
+	Morph     int       // Morph target whose weight is changed by keys.
+	MaxMorphs int       // Morph target weights the shader holds.
 
 	// Shaders
-	Programs    [numPrograms]uint32
-	VAOs        [numVAOs]uint32
-	NumVertices [numVAOs]int32
-	Buffers     [numBuffers]uint32
+	Programs   [numPrograms]uint32
+	VAOs       []uint32             // One per level of detail.
+	Buffers    [][numBuffers]uint32 // One set per level of detail.
+	IndexTypes []uint32             // UNSIGNED_SHORT or UNSIGNED_INT.
 
 	// Uniforms
 	ProjMatrix   mgl32.Mat4
@@ -101,10 +138,24 @@ type Scene struct {
 	LightColorLoc   int32
 	LightPowerLoc   int32
 	UseColorMapLoc  int32
+	JointMatrixLoc  int32
+	SkinnedLoc      int32
+	MorphWeightsLoc int32
 
 	// Texture Locations
 	ColorMapLoc  int32
 	NormalMapLoc int32
+
+	// Textures of each material of the model, followed by those of parts
+	// with no material.
+	Textures []materialTextures
+}
+
+// materialTextures holds the textures bound to draw parts with a material,
+// zero for none.
+type materialTextures struct {
+	Color  uint32
+	Normal uint32
 }
 
 // Setup resources required to update/display the scene.
@@ -133,11 +184,30 @@ func (s *Scene) Setup(ctx *app.Context) error {
 	gl.Enable(gl.CULL_FACE)
 	gl.Enable(gl.DEPTH_TEST)
 
-	s.ProjMatrix = mgl32.Perspective(mgl32.DegToRad(45.0), float32(ctx.ScreenWidth)/float32(ctx.ScreenHeight), 0.1, 10.0)
+	s.Source = model.New()
+	if err := s.Source.LoadFileWith(s.ModelFile, s.LoadOptions); err != nil {
+		return fmt.Errorf("could not load model: %s", err)
+	}
+	if s.Fit {
+		s.Source.Fit()
+	}
+	for i, w := range s.MorphWeights {
+		if i < len(s.Source.Morphs) {
+			s.Source.Morphs[i].Weight = w
+		}
+	}
+
+	fovy := mgl32.DegToRad(45.0)
+	eye, near, far := mgl32.Vec3{3, 3, 3}, float32(0.1), float32(10.0)
+	if !s.Fit {
+		eye, near, far = s.frame(fovy)
+	}
+
+	s.ProjMatrix = mgl32.Perspective(fovy, float32(ctx.ScreenWidth)/float32(ctx.ScreenHeight), near, far)
 	s.ProjMatrixLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("ProjMatrix\x00"))
 	gl.UniformMatrix4fv(s.ProjMatrixLoc, 1, false, &s.ProjMatrix[0])
 
-	s.ViewMatrix = mgl32.LookAtV(mgl32.Vec3{3, 3, 3}, mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 1, 0})
+	s.ViewMatrix = mgl32.LookAtV(eye, mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 1, 0})
 	s.ViewMatrixLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("ViewMatrix\x00"))
 	gl.UniformMatrix4fv(s.ViewMatrixLoc, 1, false, &s.ViewMatrix[0])
 
@@ -145,72 +215,42 @@ func (s *Scene) Setup(ctx *app.Context) error {
 	s.ModelMatrixLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("ModelMatrix\x00"))
 	gl.UniformMatrix4fv(s.ModelMatrixLoc, 1, false, &modelMatrix[0])
 
-	s.UseColorMapLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("UseColorMap\x00"))
-	if s.ColorFile != "" {
-		gl.Uniform1i(s.UseColorMapLoc, 1)
-		s.ColorMapLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("ColorMap\x00"))
-		gl.Uniform1i(s.ColorMapLoc, 0)
-		colorMap, err := os.Open(s.ColorFile)
-		defer colorMap.Close()
-		if err != nil {
-			log.Fatalln("failed to open tex:", err)
-		}
-		if _, err := loadTex(colorMap, gl.TEXTURE0); err != nil {
-			log.Fatalln(err)
-		}
-	} else {
-		gl.Uniform1i(s.UseColorMapLoc, 0)
+	if s.Normals == "" && !s.Source.HasNormals {
+		s.Normals = model.AngleNormals.String()
+	}
+	if err := s.buildModel(); err != nil {
+		return err
 	}
 
-	if s.NormalFile != "" {
-		s.NormalMapLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("NormalMap\x00"))
-		gl.Uniform1i(s.NormalMapLoc, 1)
-		normalMap, err := os.Open(s.NormalFile)
-		defer normalMap.Close()
-		if err != nil {
-			log.Fatalln("failed to open tex:", err)
-		}
-		if _, err := loadTex(normalMap, gl.TEXTURE1); err != nil {
-			log.Fatalln(err)
-		}
+	s.UseColorMapLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("UseColorMap\x00"))
+	s.ColorMapLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("ColorMap\x00"))
+	gl.Uniform1i(s.ColorMapLoc, 0)
+	s.NormalMapLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("NormalMap\x00"))
+	gl.Uniform1i(s.NormalMapLoc, 1)
+	if err := s.loadTextures(); err != nil {
+		return err
 	}
 
 	gl.BindFragDataLocation(s.Programs[progID], 0, gl.Str("FragColor\x00"))
 
-	mdlReader, err := os.Open(s.ModelFile)
-	defer mdlReader.Close()
-	if err != nil {
-		log.Fatalln("could not open model:", err)
+	if s.Playing, err = s.animationIndex(); err != nil {
+		return err
+	}
+	s.JointMatrixLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("JointMatrix\x00"))
+	s.SkinnedLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("Skinned\x00"))
+	s.MaxJoints = s.uniformSize("JointMatrix")
+	if n := s.Source.MaxJoints(); n > s.MaxJoints {
+		log.Printf("model has skins of %d joints, the shader holds %d", n, s.MaxJoints)
 	}
-	s.Model = model.New()
-	if err := s.Model.Load(mdlReader); err != nil {
-		log.Fatalln("could not load model:", err)
+	s.MorphWeightsLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("MorphWeights\x00"))
+	s.MaxMorphs = s.uniformSize("MorphWeights")
+	if n := s.Source.MaxMorphs(); n > s.MaxMorphs {
+		log.Printf("model has parts of %d morph targets, the shader holds %d", n, s.MaxMorphs)
 	}
+	s.pose()
 
 	// Configure the vertex data
-	gl.GenVertexArrays(numVAOs, &s.VAOs[0])
-	gl.BindVertexArray(s.VAOs[triangleName])
-
-	gl.GenBuffers(numBuffers, &s.Buffers[0])
-	gl.BindBuffer(gl.ARRAY_BUFFER, s.Buffers[aBufferName])
-	gl.BufferData(gl.ARRAY_BUFFER, len(s.Model.VertexData)*8, gl.Ptr(s.Model.VertexData), gl.STATIC_DRAW)
-
-	mcVertexLoc := uint32(gl.GetAttribLocation(s.Programs[progID], gl.Str("MCVertex\x00")))
-	gl.EnableVertexAttribArray(mcVertexLoc)
-	gl.VertexAttribPointer(mcVertexLoc, 3, gl.FLOAT, false, 8*4, gl.PtrOffset(0))
-
-	mcNormalLoc := uint32(gl.GetAttribLocation(s.Programs[progID], gl.Str("MCNormal\x00")))
-	gl.EnableVertexAttribArray(mcNormalLoc)
-	gl.VertexAttribPointer(mcNormalLoc, 3, gl.FLOAT, false, 8*4, gl.PtrOffset(3*4))
-
-	texCoordLoc := uint32(gl.GetAttribLocation(s.Programs[progID], gl.Str("TexCoord0\x00")))
-	gl.EnableVertexAttribArray(texCoordLoc)
-	gl.VertexAttribPointer(texCoordLoc, 2, gl.FLOAT, false, 8*4, gl.PtrOffset(6*4))
-
-	var fbo uint32
-	gl.GenBuffers(1, &fbo)
-	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, fbo)
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(s.Model.FaceData)*4, gl.Ptr(s.Model.FaceData), gl.STATIC_DRAW)
+	s.uploadModel()
 
 	s.LightPosLoc = gl.GetUniformLocation(s.Programs[progID], gl.Str("LightPos\x00"))
 	gl.Uniform3f(s.LightPosLoc, s.LightPos[0], s.LightPos[1], s.LightPos[2])
@@ -227,8 +267,298 @@ func (s *Scene) Setup(ctx *app.Context) error {
 	return nil
 }
 
+// loadTextures loads the textures of each material of the model.  The
+// textures given by ColorFile and NormalFile are used for every part
+// instead, when set.
+func (s *Scene) loadTextures() error {
+	loaded := make(map[string]uint32)
+	load := func(filename string, data []byte, unit uint32) (uint32, error) {
+		if filename == "" && data == nil {
+			return 0, nil
+		}
+		if tex, ok := loaded[filename]; ok && data == nil {
+			return tex, nil
+		}
+		r, err := openTex(filename, data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open tex: %s", err)
+		}
+		defer r.Close()
+		tex, err := loadTex(r, unit)
+		if err != nil {
+			return 0, err
+		}
+		if data == nil {
+			loaded[filename] = tex
+		}
+		return tex, nil
+	}
+
+	materials := append(append([]model.Material(nil), s.Source.Materials...), model.Material{})
+	s.Textures = make([]materialTextures, len(materials))
+	for i, m := range materials {
+		if s.ColorFile != "" {
+			m.ColorMap, m.ColorMapData = s.ColorFile, nil
+		}
+		if s.NormalFile != "" {
+			m.NormalMap, m.NormalMapData = s.NormalFile, nil
+		}
+		var err error
+		if s.Textures[i].Color, err = load(m.ColorMap, m.ColorMapData, gl.TEXTURE0); err != nil {
+			return err
+		}
+		if s.Textures[i].Normal, err = load(m.NormalMap, m.NormalMapData, gl.TEXTURE1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindTextures binds the textures of the given material, -1 for none.
+func (s *Scene) bindTextures(material int) {
+	t := s.Textures[len(s.Textures)-1]
+	if material >= 0 && material < len(s.Textures)-1 {
+		t = s.Textures[material]
+	}
+	if t.Color != 0 {
+		gl.Uniform1i(s.UseColorMapLoc, 1)
+	} else {
+		gl.Uniform1i(s.UseColorMapLoc, 0)
+	}
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, t.Color)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, t.Normal)
+}
+
+// frame returns a camera position, looking at the origin, and near and far
+// planes that keep the whole model in view as it rotates about the origin.
+func (s *Scene) frame(fovy float32) (eye mgl32.Vec3, near, far float32) {
+	center, radius := s.Source.BoundingSphere()
+	radius += mgl32.Vec3(center).Len()
+	if radius == 0 {
+		radius = 1
+	}
+	dist := radius / float32(math.Sin(float64(fovy)/2))
+	eye = mgl32.Vec3{1, 1, 1}.Normalize().Mul(dist)
+	near = dist - radius
+	if near < radius/100 {
+		near = radius / 100
+	}
+	return eye, near, dist + radius
+}
+
+// buildModel derives the displayed model from the loaded one.
+func (s *Scene) buildModel() error {
+	s.Model = s.Source.Clone()
+	if s.Subdivision != "" && s.Subdivisions > 0 {
+		scheme, err := model.ParseSubdivisionScheme(s.Subdivision)
+		if err != nil {
+			return err
+		}
+		s.Model = s.Model.Subdivide(scheme, s.Subdivisions, s.SubdivisionCrease)
+		log.Printf("subdivided: %d triangles", s.Model.FaceCount)
+	}
+	if s.Normals != "" {
+		mode, err := model.ParseNormalMode(s.Normals)
+		if err != nil {
+			return err
+		}
+		s.Model.GenerateNormals(mode, s.CreaseAngle)
+		s.Model.HasTangents = false
+	}
+	if !s.Model.HasTangents {
+		s.Model.GenerateTangents()
+	}
+	if s.Weld {
+		s.Model.Weld(float32(s.WeldEpsilon))
+	}
+
+	s.LODs = append([]model.Model{s.Model}, s.Model.LODs(s.LODRatios)...)
+	for i := range s.LODs {
+		m := &s.LODs[i]
+		if i > 0 {
+			log.Printf("LOD %d: %d triangles", i, m.FaceCount)
+		}
+		if s.Optimize {
+			before := m.ACMR(s.CacheSize)
+			m.OptimizeTriangles(s.CacheSize)
+			m.OptimizeVertexFetch()
+			log.Printf("LOD %d ACMR: %.3f -> %.3f", i, before, m.ACMR(s.CacheSize))
+		}
+	}
+	if s.LOD >= len(s.LODs) {
+		s.LOD = len(s.LODs) - 1
+	}
+	s.Model = s.LODs[s.LOD]
+	return nil
+}
+
+// uploadModel copies each level of detail into its own vertex and element
+// buffers, using 16 bit indices when the model is small enough.
+func (s *Scene) uploadModel() {
+	for len(s.VAOs) < len(s.LODs) {
+		var vao uint32
+		var buffers [numBuffers]uint32
+		gl.GenVertexArrays(1, &vao)
+		gl.GenBuffers(numBuffers, &buffers[0])
+		s.VAOs = append(s.VAOs, vao)
+		s.Buffers = append(s.Buffers, buffers)
+		s.IndexTypes = append(s.IndexTypes, gl.UNSIGNED_INT)
+	}
+
+	for i, m := range s.LODs {
+		gl.BindVertexArray(s.VAOs[i])
+		gl.BindBuffer(gl.ARRAY_BUFFER, s.Buffers[i][aBufferName])
+		gl.BufferData(gl.ARRAY_BUFFER, len(m.VertexData)*4, gl.Ptr(m.VertexData), gl.STATIC_DRAW)
+		gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, s.Buffers[i][eBufferName])
+		if m.ShortIndices() && len(m.FaceData) > 0 {
+			indices := m.FaceData16()
+			gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*2, gl.Ptr(indices), gl.STATIC_DRAW)
+			s.IndexTypes[i] = gl.UNSIGNED_SHORT
+		} else {
+			gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(m.FaceData)*4, gl.Ptr(m.FaceData), gl.STATIC_DRAW)
+			s.IndexTypes[i] = gl.UNSIGNED_INT
+		}
+		missing := s.bindAttributes(m)
+		if i == 0 && len(missing) > 0 {
+			log.Println("model has no data for vertex inputs:", strings.Join(missing, ", "))
+		}
+	}
+}
+
+// bindAttributes points each active vertex input of the program at the
+// attribute of m with the same name, in the array buffer bound to the
+// current vertex array.  Inputs m has no data for are given the attribute's
+// default value, and their names returned, unless they are for skinning or
+// morph targets, which most models have no data for.
+func (s *Scene) bindAttributes(m model.Model) []string {
+	prog := s.Programs[progID]
+	var count, maxLength int32
+	gl.GetProgramiv(prog, gl.ACTIVE_ATTRIBUTES, &count)
+	gl.GetProgramiv(prog, gl.ACTIVE_ATTRIBUTE_MAX_LENGTH, &maxLength)
+	buf := make([]uint8, maxLength+1)
+
+	var missing []string
+	for i := uint32(0); i < uint32(count); i++ {
+		var length, size int32
+		var xtype uint32
+		gl.GetActiveAttrib(prog, i, int32(len(buf)), &length, &size, &xtype, &buf[0])
+		name := string(buf[:length])
+
+		// Built in inputs such as gl_VertexID have no location.
+		loc := gl.GetAttribLocation(prog, &buf[0])
+		if loc < 0 {
+			continue
+		}
+		a, ok := m.Attribute(name)
+		if !ok {
+			d := model.DefaultValue(name)
+			gl.DisableVertexAttribArray(uint32(loc))
+			gl.VertexAttrib4f(uint32(loc), d[0], d[1], d[2], d[3])
+			if name != model.JointsAttribute && name != model.WeightsAttribute && !model.IsMorphAttribute(name) {
+				missing = append(missing, name)
+			}
+			continue
+		}
+		gl.EnableVertexAttribArray(uint32(loc))
+		gl.VertexAttribPointer(uint32(loc), int32(a.Size), gl.FLOAT, false, int32(m.Stride*4), gl.PtrOffset(a.Offset*4))
+	}
+	return missing
+}
+
+// uniformSize returns the number of elements of the named uniform array
+// of the program, 1 if it is not an array and 0 if it is not active.
+func (s *Scene) uniformSize(name string) int {
+	prog := s.Programs[progID]
+	var count, maxLength int32
+	gl.GetProgramiv(prog, gl.ACTIVE_UNIFORMS, &count)
+	gl.GetProgramiv(prog, gl.ACTIVE_UNIFORM_MAX_LENGTH, &maxLength)
+	buf := make([]uint8, maxLength+1)
+	for i := uint32(0); i < uint32(count); i++ {
+		var length, size int32
+		var xtype uint32
+		gl.GetActiveUniform(prog, i, int32(len(buf)), &length, &size, &xtype, &buf[0])
+		if n := string(buf[:length]); n == name || n == name+"[0]" {
+			return int(size)
+		}
+	}
+	return 0
+}
+
+// animationIndex returns the index of the animation named by Animation,
+// which may also be its index, or the first if it is empty.
+func (s *Scene) animationIndex() (int, error) {
+	if s.Animation == "" {
+		if len(s.Source.Animations) == 0 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+	if i := s.Source.AnimationIndex(s.Animation); i >= 0 {
+		return i, nil
+	}
+	if i, err := strconv.Atoi(s.Animation); err == nil && i >= 0 && i < len(s.Source.Animations) {
+		return i, nil
+	}
+	return -1, fmt.Errorf("model has no animation %s", s.Animation)
+}
+
+// pose computes the joint matrices of each skin of the model and the
+// weights of its morph targets, posed by the animation played at Time.
+func (s *Scene) pose() {
+	pose := s.Model.Pose(s.Playing, s.Time)
+	s.JointMatrices = s.JointMatrices[:0]
+	for i := range s.Model.Skins {
+		s.JointMatrices = append(s.JointMatrices, s.Model.JointMatrices(i, pose))
+	}
+	s.Weights = s.Model.MorphWeights(pose)
+}
+
+// setMorphWeight sets the weight at rest of morph target i of the loaded
+// model and of each level of detail built from it.
+func (s *Scene) setMorphWeight(i int, w float32) {
+	s.Source.Morphs[i].Weight = w
+	for j := range s.LODs {
+		s.LODs[j].Morphs[i].Weight = w
+	}
+	s.Model = s.LODs[s.LOD]
+}
+
+// seek moves the animation played by dt seconds, wrapping around its
+// duration.
+func (s *Scene) seek(dt float32) {
+	if s.Playing < 0 {
+		return
+	}
+	d := s.Model.Animations[s.Playing].Duration
+	if d <= 0 {
+		s.Time = 0
+		return
+	}
+	s.Time = float32(math.Mod(float64(s.Time+dt), float64(d)))
+	if s.Time < 0 {
+		s.Time += d
+	}
+}
+
 // Update the state of your scene.
 func (s *Scene) Update(dt float32) {
+	if s.rebuild {
+		s.rebuild = false
+		if err := s.buildModel(); err != nil {
+			log.Println("could not rebuild model:", err)
+		} else {
+			s.uploadModel()
+		}
+	}
+	if !s.Paused {
+		s.seek(dt)
+	}
+	if len(s.Model.Skins) > 0 || len(s.Model.Morphs) > 0 {
+		s.pose()
+	}
+
 	s.Angle[0] += dt * 10 * 3.0
 	s.Angle[1] += dt * 10 * 10.0
 	s.Angle[2] += dt * 10 * 7.0
@@ -244,22 +574,54 @@ func (s *Scene) Display() {
 	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
 	gl.UseProgram(s.Programs[progID])
-	gl.UniformMatrix4fv(s.ModelMatrixLoc, 1, false, &s.ModelMatrix[0])
-	gl.BindVertexArray(s.VAOs[triangleName])
+	gl.BindVertexArray(s.VAOs[s.LOD])
+	indexSize := 4
+	if s.IndexTypes[s.LOD] == gl.UNSIGNED_SHORT {
+		indexSize = 2
+	}
 
-	/*
-		if _, ok := shader.Tex[gl.TEXTURE0]; ok {
-			gl.ActiveTexture(gl.TEXTURE0)
-			gl.BindTexture(gl.TEXTURE_2D, shader.Tex[gl.TEXTURE0])
+	// Each part is drawn with its own transform and textures.
+	for _, p := range s.Model.Parts() {
+		if p.Count == 0 {
+			continue
 		}
-
-		if _, ok := shader.Tex[gl.TEXTURE1]; ok {
-			gl.ActiveTexture(gl.TEXTURE1)
-			gl.BindTexture(gl.TEXTURE_2D, shader.Tex[gl.TEXTURE1])
+		modelMatrix := s.ModelMatrix.Mul4(mgl32.Mat4(p.Transform))
+		gl.UniformMatrix4fv(s.ModelMatrixLoc, 1, false, &modelMatrix[0])
+		if p.Mirrored() {
+			gl.FrontFace(gl.CW)
+		} else {
+			gl.FrontFace(gl.CCW)
 		}
-	*/
+		s.bindTextures(p.Material)
+		s.bindJoints(p.Skin)
+		s.bindMorphs(p)
+		gl.DrawElements(gl.TRIANGLES, int32(p.Count)*3, s.IndexTypes[s.LOD], gl.PtrOffset(3*p.First*indexSize))
+	}
+}
 
-	gl.DrawElements(gl.TRIANGLES, int32(s.Model.FaceCount)*3, gl.UNSIGNED_INT, nil)
+// bindJoints uploads the joint matrices of the given skin, -1 for none.
+// Skins of more joints than the shader holds are drawn unskinned.
+func (s *Scene) bindJoints(skin int) {
+	if skin < 0 || skin >= len(s.JointMatrices) || len(s.JointMatrices[skin]) > s.MaxJoints {
+		gl.Uniform1i(s.SkinnedLoc, 0)
+		return
+	}
+	joints := s.JointMatrices[skin]
+	if len(joints) > 0 {
+		gl.UniformMatrix4fv(s.JointMatrixLoc, int32(len(joints)), false, &joints[0][0])
+	}
+	gl.Uniform1i(s.SkinnedLoc, 1)
+}
+
+// bindMorphs uploads the weights of the morph targets deforming the given
+// part, as many as the shader holds, with zeros for the rest.
+func (s *Scene) bindMorphs(part model.Group) {
+	if s.MaxMorphs == 0 {
+		return
+	}
+	weights := make([]float32, s.MaxMorphs)
+	copy(weights, part.Morphs(s.Weights))
+	gl.Uniform1fv(s.MorphWeightsLoc, int32(len(weights)), &weights[0])
 }
 
 // Cleanup any resources allocated in Setup.
@@ -282,10 +644,76 @@ func cursorPositionCallback(w *glfw.Window, x, y float64) {
 	*/
 }
 
-func KeyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+func (s *Scene) KeyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
 	if action == glfw.Release && key == glfw.KeyEscape {
 		w.SetShouldClose(true)
 	}
+	if action == glfw.Release && key == glfw.KeyN {
+		s.Normals = nextNormals(s.Normals)
+		s.rebuild = true
+		log.Println("normals:", normalsName(s.Normals))
+	}
+	if action == glfw.Release && (key == glfw.KeyLeftBracket || key == glfw.KeyRightBracket) {
+		lod := s.LOD + 1
+		if key == glfw.KeyRightBracket {
+			lod = s.LOD - 1
+		}
+		if lod >= 0 && lod < len(s.LODs) {
+			s.LOD = lod
+			s.Model = s.LODs[lod]
+		}
+		log.Printf("LOD %d: %d triangles", s.LOD, s.Model.FaceCount)
+	}
+	if action == glfw.Release && key == glfw.KeyV {
+		s.Subdivision = nextSubdivision(s.Subdivision)
+		if s.Subdivision != "" && s.Subdivisions == 0 {
+			s.Subdivisions = 1
+		}
+		s.rebuild = true
+		log.Println("subdivision:", subdivisionName(s.Subdivision))
+	}
+	if action == glfw.Release && (key == glfw.KeyComma || key == glfw.KeyPeriod) {
+		levels := s.Subdivisions - 1
+		if key == glfw.KeyPeriod {
+			levels = s.Subdivisions + 1
+		}
+		if levels >= 0 && levels <= maxSubdivisions {
+			s.Subdivisions = levels
+			s.rebuild = s.Subdivision != ""
+		}
+		log.Printf("subdivision: %s, %d levels", subdivisionName(s.Subdivision), s.Subdivisions)
+	}
+	if action == glfw.Release && key == glfw.KeySpace {
+		s.Paused = !s.Paused
+		log.Printf("animation: paused %t at %.2fs", s.Paused, s.Time)
+	}
+	if (action == glfw.Press || action == glfw.Repeat) && (key == glfw.KeyLeft || key == glfw.KeyRight) {
+		step := float32(1.0 / 30)
+		if key == glfw.KeyLeft {
+			step = -step
+		}
+		s.seek(step)
+		log.Printf("animation: %.2fs", s.Time)
+	}
+	if action == glfw.Release && key == glfw.KeyTab && len(s.Model.Animations) > 0 {
+		s.Playing = (s.Playing + 1) % len(s.Model.Animations)
+		s.Time = 0
+		log.Printf("animation %d: %s", s.Playing, s.Model.Animations[s.Playing].Name)
+	}
+	if action == glfw.Release && key == glfw.KeyM && len(s.Model.Morphs) > 0 {
+		s.Morph = (s.Morph + 1) % len(s.Model.Morphs)
+		t := s.Model.Morphs[s.Morph]
+		log.Printf("morph target %d: %s, weight %.1f", s.Morph, t.Name, t.Weight)
+	}
+	if (action == glfw.Press || action == glfw.Repeat) && (key == glfw.KeyUp || key == glfw.KeyDown) && s.Morph < len(s.Model.Morphs) {
+		step := 0.1
+		if key == glfw.KeyDown {
+			step = -step
+		}
+		w := float32(math.Max(0, math.Min(1, float64(s.Model.Morphs[s.Morph].Weight)+step)))
+		s.setMorphWeight(s.Morph, w)
+		log.Printf("morph target %d: %s, weight %.1f", s.Morph, s.Model.Morphs[s.Morph].Name, w)
+	}
 	/*
 		if action == glfw.Release && key == glfw.KeyEqual {
 			LightPos[2] += 1
@@ -377,6 +805,60 @@ func KeyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action,
 	*/
 }
 
+// normalModes lists the normals cycled through at runtime, starting with the
+// model's own.
+var normalModes = []string{
+	"",
+	model.FlatNormals.String(),
+	model.SmoothNormals.String(),
+	model.AngleNormals.String(),
+	model.CreaseNormals.String(),
+}
+
+func nextNormals(current string) string {
+	for i := range normalModes {
+		if normalModes[i] == current {
+			return normalModes[(i+1)%len(normalModes)]
+		}
+	}
+	return normalModes[0]
+}
+
+func normalsName(mode string) string {
+	if mode == "" {
+		return "model"
+	}
+	return mode
+}
+
+// maxSubdivisions limits the levels of subdivision set at runtime, as each
+// level multiplies the triangles by four.
+const maxSubdivisions = 5
+
+// subdivisions lists the subdivision schemes cycled through at runtime,
+// starting with none.
+var subdivisions = []string{
+	"",
+	model.LoopSubdivision.String(),
+	model.CatmullClarkSubdivision.String(),
+}
+
+func nextSubdivision(current string) string {
+	for i := range subdivisions {
+		if subdivisions[i] == current {
+			return subdivisions[(i+1)%len(subdivisions)]
+		}
+	}
+	return subdivisions[0]
+}
+
+func subdivisionName(scheme string) string {
+	if scheme == "" {
+		return "none"
+	}
+	return scheme
+}
+
 func mouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mod glfw.ModifierKey) {
 	/*
 		if (action == glfw.Press || action == glfw.Repeat) && button == glfw.MouseButtonLeft {
@@ -388,6 +870,14 @@ func mouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Ac
 	*/
 }
 
+// openTex opens the named texture file, or reads data when it is set.
+func openTex(filename string, data []byte) (io.ReadCloser, error) {
+	if data != nil {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return os.Open(filename)
+}
+
 func loadTex(r io.Reader, id uint32) (uint32, error) {
 	img, _, err := image.Decode(r)
 	if err != nil {